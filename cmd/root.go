@@ -1,13 +1,26 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/rsvinicius/dotme/internal"
 	"github.com/rsvinicius/dotme/internal/alias"
+	"github.com/rsvinicius/dotme/internal/backup"
+	"github.com/rsvinicius/dotme/internal/fs"
+	"github.com/rsvinicius/dotme/internal/git"
 	"github.com/rsvinicius/dotme/internal/patterns"
+	"github.com/rsvinicius/dotme/internal/secret"
+	"github.com/rsvinicius/dotme/internal/source"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 var (
@@ -17,38 +30,167 @@ var (
 	date    string
 
 	// Command flags
-	aliasFlag       string
-	saveFlag        string
-	includePatterns string
-	excludePatterns string
+	aliasFlag          string
+	saveFlag           string
+	refFlag            string
+	fullCloneFlag      bool
+	noCacheFlag        bool
+	offlineFlag        bool
+	pathFlag           string
+	sshKeyFlag         string
+	noSubmodules       bool
+	noLFSFlag          bool
+	verboseFlag        bool
+	timeoutFlag        time.Duration
+	dryRunFlag         bool
+	diffFlag           bool
+	onConflictFlags    []string
+	mergeArraysFlag    string
+	promptFallbackFlag string
+	linkFlag           string
+	symlinksFlag       string
+	targetFlag         string
+	createTargetFlag   bool
+	varFlags           []string
+	keyFileFlag        string
+	showSecretsFlag    bool
+	outputFlag         string
+	pruneDaysFlag      int
+	includePatterns    string
+	excludePatterns    string
 )
 
 var rootCmd = &cobra.Command{
-	Use:   "dotme [git-repository-url]",
+	Use:   "dotme [repository-url|path|archive]",
 	Short: "Apply dotfiles from a Git repository",
 	Long: `dotme is a command line tool that applies dotfiles from a Git repository to your current working directory.
 It only copies files and folders starting with a dot (.) from the root of the repository.
 
+Use --target to apply them to another directory, such as --target ~ to bootstrap a home
+directory from a script. A missing target is only created with --create-target.
+
+The repository may also be a local path or file:// URL pointing to a git working tree or a
+plain directory, which is used in place without cloning (uncommitted changes included), or a
+.tar.gz, .tgz or .zip archive given as a local path or HTTP(S) URL.
+
+Use --path, or append //<subdir> to the repository (e.g. https://github.com/org/dotfiles//go),
+to apply dotfiles from a subdirectory. Subdirectories given when saving an alias are stored with it.
+
 You can use include and exclude patterns to filter which dotfiles are copied:
   --include: Comma-separated list of patterns to include (e.g., ".vscode,.gitconfig")
   --exclude: Comma-separated list of patterns to exclude (e.g., ".DS_Store")
 
-Patterns support glob matching (*, ?, [abc], etc.).`,
+Patterns support glob matching (*, ?, [abc], etc.).
+
+Use --ref to apply dotfiles from a specific branch, tag or commit instead of the
+repository's default branch. Repositories are cloned shallowly (depth 1, single branch)
+unless --full-clone is given or the ref is a commit that requires the full history.
+
+Clones are kept in a cache under ~/.dotme/cache and updated incrementally on later runs.
+Use --no-cache to clone into a temporary directory instead. With --offline, or when the
+repository cannot be reached, dotme applies the most recently fetched cached copy.
+
+Private repositories are accessed over SSH with the SSH agent, --ssh-key or the default keys
+in ~/.ssh, and over HTTPS with a token from DOTME_GIT_TOKEN (or GITHUB_TOKEN, GH_TOKEN and
+GITLAB_TOKEN for their hosts), ~/.netrc or the git credential helper. Use --verbose to show
+the authentication method used.
+
+Git submodules are initialized and checked out recursively so their contents are copied like
+regular files. Use --no-submodules to skip them.
+
+Git LFS pointer files are detected before anything is copied and replaced by their objects,
+fetched from the repository's LFS endpoint. If an object cannot be fetched, or with --no-lfs,
+dotme refuses to apply and lists the affected paths.
+
+Use --timeout to abort when cloning and copying take too long. On timeout or Ctrl-C, temporary
+files are removed. Files are staged and renamed into place only after all of them were written,
+so on any failure the destination is rolled back to its original state.
+
+Use --dry-run to preview which files would be created, overwritten or left unchanged, with
+their sizes and modes, without modifying the destination. Use --diff, or the diff command, to
+print a unified diff of each file that would change.
+
+Use --on-conflict to choose what happens to existing files with different content:
+  overwrite: replace them (default)
+  skip:      keep them
+  backup:    copy them to <file>.bak, then replace them
+  prompt:    ask for each file whether to overwrite, keep, view the diff, back up or abort
+  fail:      copy nothing and exit with an error if any file conflicts
+
+When standard input is not a terminal, prompt falls back to --prompt-fallback (skip by default).
+
+Give --on-conflict=<strategy>:<pattern> to use another strategy for the files whose path matches
+the pattern (or whose name does, for patterns without a slash). The merge strategy, only available
+this way, deep-merges incoming JSON and JSONC files into existing ones, keeping existing keys and
+comments, e.g. --on-conflict=merge:.vscode/*.json. Use --merge-arrays to choose whether arrays
+present in both files are replaced (default), combined without duplicates (union) or kept.
+Ignore files such as .gitignore and .dockerignore are merged line by line instead: missing lines
+are appended and existing ones kept, e.g. --on-conflict='merge:.*ignore'.
+
+The block strategy, also only available per pattern, writes the incoming content between
+"# >>> dotme:<alias> >>>" and "# <<< dotme:<alias> <<<" lines, so shared configuration can live
+next to local configuration in one file, e.g. --on-conflict=block:.bashrc. Re-applying replaces
+only that block. Blocks are named after the alias, or the repository name without one.
+
+Use --link to symlink dotfiles instead of copying them. The repository is kept in a persistent
+checkout under ~/.dotme/repos/<alias> (or a name derived from the URL without --alias), so edits
+to linked files can be committed there, and later runs update it when it has no local changes.
+Local working trees are linked in place. --link=file (the default) links every file and creates
+real directories, while --link=dir links each root entry, including whole directories. Existing
+links are replaced, and existing files are handled by --on-conflict.
+
+Files ending in .tmpl are rendered with Go's text/template and written without the suffix.
+Templates can use {{ .Hostname }}, {{ .OS }}, {{ .Arch }}, {{ .Username }}, {{ .HomeDir }},
+{{ .GitEmail }} and variables under {{ .Vars.<name> }}, saved with 'dotme config set-var' or
+given with --var name=value.
+
+Files ending in .enc, created with 'dotme encrypt', are decrypted in memory and written without
+the suffix and with mode 0600. The secret is read from --key-file, DOTME_PASSPHRASE or
+~/.dotme/key, or prompted for. Encrypted templates end in .tmpl.enc. Diffs only show hashes
+of decrypted content unless --show-secrets is given.
+
+Symbolic links in the repository are copied as the files they point to by default. Use
+--symlinks=preserve to recreate them as links instead, or --symlinks=skip to leave them out.
+Links pointing outside the repository are rejected.`,
 	Args: cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		// Parse patterns
-		includeList := patterns.ParsePatterns(includePatterns)
-		excludeList := patterns.ParsePatterns(excludePatterns)
+		strategy, rules, err := conflictStrategy()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+		link, err := fs.ParseLinkMode(linkFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		options, err := sourceOptions()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+		options.DryRun = dryRunFlag
+		options.Diff = diffFlag
+		options.OnConflict = strategy
+		options.ConflictRules = rules
+		if options.MergeArrays, err = fs.ParseArrayMerge(mergeArraysFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+		options.Resolve = fs.NewConflictPrompt(os.Stdin, os.Stdout, options.Color, options.ShowSecrets)
+		options.Link = link
 
 		// Check for alias flag first
 		if aliasFlag != "" {
+			options.Alias = aliasFlag
 			repoURL, err := alias.GetRepo(aliasFlag)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 				os.Exit(1)
 			}
 			fmt.Printf("🔍 Using alias '%s' for repository: %s\n", aliasFlag, repoURL)
-			err = internal.ProcessRepository(repoURL, includeList, excludeList)
+			err = applyRepository(repoURL, options)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 				os.Exit(1)
@@ -62,8 +204,12 @@ Patterns support glob matching (*, ?, [abc], etc.).`,
 				fmt.Fprintf(os.Stderr, "Error: repository URL is required when using --save\n")
 				os.Exit(1)
 			}
-			repoURL := args[0]
-			err := alias.SaveRepo(repoURL, saveFlag)
+			repoURL, err := source.JoinSubdir(args[0], pathFlag)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+				os.Exit(1)
+			}
+			err = alias.SaveRepo(repoURL, saveFlag)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 				os.Exit(1)
@@ -82,7 +228,65 @@ Patterns support glob matching (*, ?, [abc], etc.).`,
 		}
 
 		repoURL := args[0]
-		err := internal.ProcessRepository(repoURL, includeList, excludeList)
+		err = applyRepository(repoURL, options)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff [repository-url|path|archive]",
+	Short: "Show a unified diff between incoming dotfiles and existing files",
+	Long: `Show a unified diff between each incoming dotfile and the existing file in the current
+directory, or the --target directory, without modifying anything. New files are shown as additions, binary files are
+reported with their sizes and permission changes are shown as old and new modes.
+
+Files matched by --on-conflict merge and block rules are compared with the content they
+would be merged into. Output is colored when writing to a terminal unless NO_COLOR is set.
+
+Examples:
+  dotme diff https://github.com/username/dotfiles
+  dotme diff -a work --include=".gitconfig"
+  dotme diff -a work --on-conflict "merge:.vscode/*.json"`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var repoURL string
+		switch {
+		case aliasFlag != "":
+			var err error
+			repoURL, err = alias.GetRepo(aliasFlag)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("🔍 Using alias '%s' for repository: %s\n", aliasFlag, repoURL)
+		case len(args) == 1:
+			repoURL = args[0]
+		default:
+			fmt.Fprintf(os.Stderr, "Error: repository URL or alias is required\n")
+			os.Exit(1)
+		}
+
+		options, err := sourceOptions()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+		options.Alias = aliasFlag
+		// Only merge and block rules change what is written, the other strategies are ignored
+		if _, options.ConflictRules, err = parseConflictFlags(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+		if options.MergeArrays, err = fs.ParseArrayMerge(mergeArraysFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+		err = runCancellable(func(ctx context.Context) error {
+			return internal.DiffRepository(ctx, repoURL, options)
+		})
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 			os.Exit(1)
@@ -215,9 +419,440 @@ var showConfigCmd = &cobra.Command{
 				}
 			}
 		}
+
+		// Show template variables
+		vars, err := alias.GetVariables()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading variables: %s\n", err)
+		} else {
+			fmt.Println("\n🧩 Template variables:")
+			if len(vars) == 0 {
+				fmt.Println("   (none)")
+			} else {
+				names := make([]string, 0, len(vars))
+				for name := range vars {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				for _, name := range names {
+					fmt.Printf("   %s = %s\n", name, vars[name])
+				}
+			}
+		}
 	},
 }
 
+var setVarCmd = &cobra.Command{
+	Use:   "set-var <name> <value>",
+	Short: "Save a template variable",
+	Long: `Save a variable that templates can use as {{ .Vars.<name> }}. Variables given with
+--var override saved variables for a single run.
+
+Examples:
+  dotme config set-var email me@example.com
+  dotme config set-var work_laptop true`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := alias.SetVariable(args[0], args[1]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ Variable '%s' saved\n", args[0])
+	},
+}
+
+var unsetVarCmd = &cobra.Command{
+	Use:   "unset-var <name>",
+	Short: "Remove a saved template variable",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := alias.UnsetVariable(args[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ Variable '%s' removed\n", args[0])
+	},
+}
+
+var encryptCmd = &cobra.Command{
+	Use:   "encrypt <file>",
+	Short: "Encrypt a dotfile so it can be committed",
+	Long: `Encrypt a file containing secrets, such as .npmrc or .netrc, into <file>.enc, which is safe
+to commit to the dotfiles repository. When applying, dotme decrypts it in memory and writes it
+without the .enc suffix and with mode 0600. Keep the plaintext file out of the repository.
+
+The file is encrypted with AES-256-GCM under a key derived from a secret, read from --key-file,
+DOTME_PASSPHRASE or ~/.dotme/key, or prompted for on the terminal. Key files must only be
+readable by their owner.
+
+Examples:
+  dotme encrypt .npmrc
+  dotme encrypt .netrc --key-file ~/.config/dotme.key
+  dotme encrypt .gitconfig.tmpl -o dotfiles/.gitconfig.tmpl.enc`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := encryptFile(args[0], outputFlag, keyFileFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// encryptFile encrypts file into output, which defaults to file with the .enc suffix
+func encryptFile(file, output, keyFile string) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	plaintext, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	if secret.IsEncrypted(plaintext) {
+		return fmt.Errorf("%s is already encrypted", file)
+	}
+	if output == "" {
+		output = file + secret.Suffix
+	}
+
+	key, err := secret.Load(keyFile, true)
+	if err != nil {
+		return err
+	}
+	encrypted, err := secret.Encrypt(plaintext, key)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt %s: %w", file, err)
+	}
+	if err := os.WriteFile(output, encrypted, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to write %s: %w", output, err)
+	}
+
+	fmt.Printf("🔒 Encrypted %s to %s\n", file, output)
+	fmt.Printf("💡 Commit %s and keep %s out of the repository\n", output, file)
+	return nil
+}
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage cached repository clones",
+}
+
+var cacheListCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "List cached repositories",
+	Aliases: []string{"ls"},
+	Run: func(cmd *cobra.Command, args []string) {
+		entries, err := git.ListCache()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		if len(entries) == 0 {
+			fmt.Println("No cached repositories found.")
+			return
+		}
+
+		fmt.Println("🗄️  Cached repositories:")
+		fmt.Println("----------------------------")
+		for _, entry := range entries {
+			if entry.URL == "" {
+				fmt.Printf("⚠️  %s: incomplete entry (%s)\n", filepath.Base(entry.Dir), fs.FormatSize(entry.Size))
+				continue
+			}
+			fmt.Printf("📦 %s\n", entry.URL)
+			fmt.Printf("   commit: %.7s, fetched: %s, size: %s\n",
+				entry.Commit, entry.FetchedAt.Format(time.RFC822), fs.FormatSize(entry.Size))
+		}
+	},
+}
+
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove cached repositories that have not been fetched recently",
+	Run: func(cmd *cobra.Command, args []string) {
+		pruned, err := git.PruneCache(time.Duration(pruneDaysFlag) * 24 * time.Hour)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		if len(pruned) == 0 {
+			fmt.Println("✅ Nothing to prune")
+			return
+		}
+
+		for _, entry := range pruned {
+			name := entry.URL
+			if name == "" {
+				name = filepath.Base(entry.Dir)
+			}
+			fmt.Printf("🗑️  Removed %s\n", name)
+		}
+		fmt.Printf("✅ Pruned %d cached repositories\n", len(pruned))
+	},
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove all cached repositories",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := git.ClearCache(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("✅ Cache cleared")
+	},
+}
+
+// sourceOptions builds the options shared by the commands that read a repository from the flags
+func sourceOptions() (*internal.Options, error) {
+	symlinks, err := fs.ParseSymlinkPolicy(symlinksFlag)
+	if err != nil {
+		return nil, err
+	}
+	vars, err := internal.ParseVars(varFlags)
+	if err != nil {
+		return nil, err
+	}
+
+	return &internal.Options{
+		Ref:             refFlag,
+		FullClone:       fullCloneFlag,
+		NoCache:         noCacheFlag,
+		Offline:         offlineFlag,
+		Path:            pathFlag,
+		SSHKey:          sshKeyFlag,
+		NoSubmodules:    noSubmodules,
+		NoLFS:           noLFSFlag,
+		Verbose:         verboseFlag,
+		Color:           colorOutput(),
+		ShowSecrets:     showSecretsFlag,
+		Symlinks:        symlinks,
+		Target:          targetFlag,
+		CreateTarget:    createTargetFlag,
+		Vars:            vars,
+		KeyFile:         keyFileFlag,
+		IncludePatterns: patterns.ParsePatterns(includePatterns),
+		ExcludePatterns: patterns.ParsePatterns(excludePatterns),
+	}, nil
+}
+
+// colorOutput reports whether diffs are colored: stdout must be a terminal and NO_COLOR unset
+func colorOutput() bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	return term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+var undoCmd = &cobra.Command{
+	Use:   "undo",
+	Short: "Revert the most recent apply",
+	Long: `Revert the most recent apply that has not been undone yet: overwritten files get their
+original content and mode back, and files created by the apply are removed.
+
+Every apply saves the original files in a backup set under ~/.dotme/backups first.
+Use 'dotme backups list' to see older applies and 'dotme backups restore <id>' to revert one.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		set, err := backup.Latest()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+		restoreBackup(set)
+	},
+}
+
+var backupsCmd = &cobra.Command{
+	Use:   "backups",
+	Short: "Manage backups of files changed by applies",
+}
+
+var backupsListCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "List backup sets, newest first",
+	Aliases: []string{"ls"},
+	Run: func(cmd *cobra.Command, args []string) {
+		sets, err := backup.List()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		if len(sets) == 0 {
+			fmt.Println("No backups found.")
+			return
+		}
+
+		fmt.Println("💾 Backup sets:")
+		fmt.Println("----------------------------")
+		for _, set := range sets {
+			var created, overwritten int
+			for _, file := range set.Files {
+				if file.Created {
+					created++
+				} else {
+					overwritten++
+				}
+			}
+
+			status := ""
+			if set.RestoredAt != nil {
+				status = fmt.Sprintf(" (restored %s)", set.RestoredAt.Format(time.RFC822))
+			}
+			fmt.Printf("📦 %s%s\n", set.ID, status)
+			fmt.Printf("   repository: %s\n", set.Repo)
+			if set.Revision != "" {
+				fmt.Printf("   revision: %s\n", set.Revision)
+			}
+			fmt.Printf("   destination: %s\n", set.DestDir)
+			fmt.Printf("   files: %d overwritten, %d created, size: %s\n", overwritten, created, fs.FormatSize(set.Size))
+		}
+	},
+}
+
+var backupsRestoreCmd = &cobra.Command{
+	Use:   "restore <id>",
+	Short: "Revert the apply recorded in a backup set",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		set, err := backup.Get(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+		restoreBackup(set)
+	},
+}
+
+var backupsPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove backup sets older than a number of days",
+	Run: func(cmd *cobra.Command, args []string) {
+		pruned, err := backup.Prune(time.Duration(pruneDaysFlag) * 24 * time.Hour)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		if len(pruned) == 0 {
+			fmt.Println("✅ Nothing to prune")
+			return
+		}
+
+		for _, set := range pruned {
+			fmt.Printf("🗑️  Removed %s\n", set.ID)
+		}
+		fmt.Printf("✅ Pruned %d backup sets\n", len(pruned))
+	},
+}
+
+// restoreBackup reverts the apply recorded in a backup set
+func restoreBackup(set *backup.Set) {
+	fmt.Printf("⏪ Reverting apply of %s from %s\n", set.Repo, set.CreatedAt.Format(time.RFC822))
+	if err := set.Restore(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("✅ Backup %s restored\n", set.ID)
+}
+
+// parseConflictFlags returns the default --on-conflict strategy and the
+// per-pattern rules as given
+func parseConflictFlags() (fs.ConflictStrategy, []fs.ConflictRule, error) {
+	strategy := fs.ConflictOverwrite
+	var rules []fs.ConflictRule
+	for _, value := range onConflictFlags {
+		if strings.Contains(value, ":") {
+			rule, err := fs.ParseConflictRule(value)
+			if err != nil {
+				return "", nil, err
+			}
+			rules = append(rules, rule)
+			continue
+		}
+		var err error
+		if strategy, err = fs.ParseConflictStrategy(value); err != nil {
+			return "", nil, err
+		}
+	}
+	return strategy, rules, nil
+}
+
+// conflictStrategy returns the default --on-conflict strategy and the
+// per-pattern rules, replacing prompt with the --prompt-fallback strategy
+// when standard input is not a terminal
+func conflictStrategy() (fs.ConflictStrategy, []fs.ConflictRule, error) {
+	strategy, rules, err := parseConflictFlags()
+	if err != nil {
+		return "", nil, err
+	}
+
+	fallback, err := fs.ParseConflictStrategy(promptFallbackFlag)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid --prompt-fallback: %w", err)
+	}
+	if fallback == fs.ConflictPrompt {
+		return "", nil, fmt.Errorf("--prompt-fallback must be a non-interactive strategy")
+	}
+
+	prompts := strategy == fs.ConflictPrompt
+	for _, rule := range rules {
+		prompts = prompts || rule.Strategy == fs.ConflictPrompt
+	}
+	if prompts && !term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Printf("ℹ️  Standard input is not a terminal, resolving conflicts with '%s'\n", fallback)
+		if strategy == fs.ConflictPrompt {
+			strategy = fallback
+		}
+		for i := range rules {
+			if rules[i].Strategy == fs.ConflictPrompt {
+				rules[i].Strategy = fallback
+			}
+		}
+	}
+	return strategy, rules, nil
+}
+
+// applyRepository applies dotfiles from a repository
+func applyRepository(repoURL string, options *internal.Options) error {
+	return runCancellable(func(ctx context.Context) error {
+		return internal.ProcessRepository(ctx, repoURL, options)
+	})
+}
+
+// runCancellable runs a function with a context that is cancelled when SIGINT
+// or SIGTERM is received or the --timeout expires
+func runCancellable(run func(ctx context.Context) error) error {
+	signalCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		// Restore the default behavior so that a second signal exits immediately
+		<-signalCtx.Done()
+		stop()
+	}()
+
+	ctx := signalCtx
+	if timeoutFlag > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(signalCtx, timeoutFlag)
+		defer cancel()
+	}
+
+	err := run(ctx)
+	if err != nil {
+		switch ctx.Err() {
+		case context.DeadlineExceeded:
+			return fmt.Errorf("timed out after %s", timeoutFlag)
+		case context.Canceled:
+			return fmt.Errorf("interrupted, temporary files were removed")
+		}
+	}
+	return err
+}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
@@ -237,21 +872,83 @@ func SetVersionInfo(v, c, d string) {
 
 func init() {
 	rootCmd.AddCommand(versionCmd)
+	rootCmd.AddCommand(diffCmd)
 	rootCmd.AddCommand(listCmd)
 	rootCmd.AddCommand(removeAliasCmd)
 	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(cacheCmd)
+	rootCmd.AddCommand(undoCmd)
+	rootCmd.AddCommand(backupsCmd)
+	rootCmd.AddCommand(encryptCmd)
 
 	// Add config subcommands
 	configCmd.AddCommand(setDefaultPatternsCmd)
 	configCmd.AddCommand(showConfigCmd)
+	configCmd.AddCommand(setVarCmd)
+	configCmd.AddCommand(unsetVarCmd)
+
+	// Add cache subcommands
+	cacheCmd.AddCommand(cacheListCmd)
+	cacheCmd.AddCommand(cachePruneCmd)
+	cacheCmd.AddCommand(cacheClearCmd)
+
+	// Add backups subcommands
+	backupsCmd.AddCommand(backupsListCmd)
+	backupsCmd.AddCommand(backupsRestoreCmd)
+	backupsCmd.AddCommand(backupsPruneCmd)
 
 	// Add flags to root command
 	rootCmd.Flags().StringVarP(&aliasFlag, "alias", "a", "", "Use a saved repository by alias")
 	rootCmd.Flags().StringVarP(&saveFlag, "save", "s", "", "Save the repository with the given alias")
-	rootCmd.Flags().StringVar(&includePatterns, "include", "", "Comma-separated list of patterns to include (e.g., '.vscode,.gitconfig')")
-	rootCmd.Flags().StringVar(&excludePatterns, "exclude", "", "Comma-separated list of patterns to exclude (e.g., '.DS_Store')")
+	rootCmd.Flags().BoolVar(&dryRunFlag, "dry-run", false, "Show which files would be created, overwritten or left unchanged without modifying the destination")
+	rootCmd.Flags().BoolVar(&diffFlag, "diff", false, "Print a unified diff of each file that changes before applying")
+	rootCmd.Flags().StringArrayVar(&onConflictFlags, "on-conflict", []string{"overwrite"}, "What to do with existing files that differ: overwrite, skip, backup, prompt or fail, or <strategy>:<pattern> for matching files, including merge and block (repeatable)")
+	rootCmd.Flags().StringVar(&mergeArraysFlag, "merge-arrays", "replace", "How arrays in merged JSON files combine: replace, union or keep")
+	rootCmd.Flags().StringVar(&promptFallbackFlag, "prompt-fallback", "skip", "Strategy used instead of prompt when standard input is not a terminal")
+	rootCmd.Flags().StringVar(&linkFlag, "link", "", "Symlink dotfiles from a persistent checkout instead of copying them, per file or per root directory (file or dir)")
+	rootCmd.Flags().Lookup("link").NoOptDefVal = string(fs.LinkFiles)
+	addSourceFlags(rootCmd)
+
+	// Add flags to diff command
+	diffCmd.Flags().StringVarP(&aliasFlag, "alias", "a", "", "Use a saved repository by alias")
+	diffCmd.Flags().StringArrayVar(&onConflictFlags, "on-conflict", nil, "Conflict rule as <strategy>:<pattern>, so that files matched by merge and block rules are diffed as they would be written (repeatable)")
+	diffCmd.Flags().StringVar(&mergeArraysFlag, "merge-arrays", "replace", "How arrays in merged JSON files combine: replace, union or keep")
+	addSourceFlags(diffCmd)
+
+	// Add flags to encrypt command
+	encryptCmd.Flags().StringVar(&keyFileFlag, "key-file", "", "Key file used to encrypt instead of DOTME_PASSPHRASE, ~/.dotme/key or a prompt")
+	encryptCmd.Flags().StringVarP(&outputFlag, "output", "o", "", "Encrypted file to write (defaults to <file>.enc)")
+
+	// Add flags to cache prune command
+	cachePruneCmd.Flags().IntVar(&pruneDaysFlag, "days", 30, "Remove repositories not fetched within this many days (0 removes all)")
+
+	// Add flags to backups prune command
+	backupsPruneCmd.Flags().IntVar(&pruneDaysFlag, "days", 30, "Remove backup sets created more than this many days ago (0 removes all)")
 
 	// Add flags to set-default-patterns command
 	setDefaultPatternsCmd.Flags().StringVar(&includePatterns, "include", "", "Comma-separated list of default include patterns")
 	setDefaultPatternsCmd.Flags().StringVar(&excludePatterns, "exclude", "", "Comma-separated list of default exclude patterns")
-}
\ No newline at end of file
+}
+
+// addSourceFlags adds the flags that select and filter the repository to a command
+func addSourceFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.StringVar(&refFlag, "ref", "", "Branch, tag or commit to apply (defaults to the repository's default branch)")
+	flags.BoolVar(&fullCloneFlag, "full-clone", false, "Clone the full repository history instead of a shallow single-branch clone")
+	flags.BoolVar(&noCacheFlag, "no-cache", false, "Clone into a temporary directory instead of using the repository cache")
+	flags.BoolVar(&offlineFlag, "offline", false, "Apply the most recently fetched cached copy without contacting the remote")
+	flags.StringVar(&pathFlag, "path", "", "Subdirectory of the repository to apply dotfiles from")
+	flags.StringVar(&sshKeyFlag, "ssh-key", "", "Private key file used for SSH repositories instead of the SSH agent or default keys")
+	flags.BoolVar(&noSubmodules, "no-submodules", false, "Do not initialize and check out git submodules")
+	flags.BoolVar(&noLFSFlag, "no-lfs", false, "Refuse to copy Git LFS pointer files instead of fetching their objects")
+	flags.StringVarP(&targetFlag, "target", "t", "", "Directory to apply the dotfiles to instead of the current directory (~ is expanded)")
+	flags.BoolVar(&createTargetFlag, "create-target", false, "Create the target directory if it does not exist")
+	flags.StringArrayVar(&varFlags, "var", nil, "Template variable as key=value, overriding the saved variables (repeatable)")
+	flags.StringVar(&keyFileFlag, "key-file", "", "Key file used to decrypt .enc files instead of DOTME_PASSPHRASE, ~/.dotme/key or a prompt")
+	flags.BoolVar(&showSecretsFlag, "show-secrets", false, "Show the decrypted content of .enc files in diffs instead of their hashes")
+	flags.StringVar(&symlinksFlag, "symlinks", "follow", "How symbolic links in the repository are applied: follow, preserve or skip")
+	flags.DurationVar(&timeoutFlag, "timeout", 0, "Abort if applying takes longer than this duration (e.g. 30s, 5m; 0 disables the timeout)")
+	flags.BoolVarP(&verboseFlag, "verbose", "v", false, "Show additional details such as the authentication method")
+	flags.StringVar(&includePatterns, "include", "", "Comma-separated list of patterns to include (e.g., '.vscode,.gitconfig')")
+	flags.StringVar(&excludePatterns, "exclude", "", "Comma-separated list of patterns to exclude (e.g., '.DS_Store')")
+}
@@ -6,18 +6,24 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 )
 
 // Errors defined for alias operations
 var (
 	ErrAliasNotFound      = errors.New("alias not found")
 	ErrAliasAlreadyExists = errors.New("alias already exists")
+	ErrVariableNotFound   = errors.New("variable not found")
 )
 
+// variableName matches names usable as {{ .Vars.name }} in templates
+var variableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
 // Config represents the structure of the configuration file
 type Config struct {
-	Repositories    map[string]string `json:"repositories"`     // Maps alias to repository URL
-	DefaultPatterns PatternConfig     `json:"default_patterns"` // Default include/exclude patterns
+	Repositories    map[string]string `json:"repositories"`        // Maps alias to repository URL
+	DefaultPatterns PatternConfig     `json:"default_patterns"`    // Default include/exclude patterns
+	Variables       map[string]string `json:"variables,omitempty"` // Template variables of this machine
 }
 
 // PatternConfig holds the default pattern configuration
@@ -26,8 +32,8 @@ type PatternConfig struct {
 	ExcludePatterns []string `json:"exclude_patterns,omitempty"`
 }
 
-// GetConfigPath returns the path to the configuration file
-func GetConfigPath() (string, error) {
+// GetConfigDir returns the dotme configuration directory, creating it if needed
+func GetConfigDir() (string, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return "", fmt.Errorf("failed to get user home directory: %w", err)
@@ -39,6 +45,16 @@ func GetConfigPath() (string, error) {
 		return "", fmt.Errorf("failed to create config directory: %w", err)
 	}
 
+	return configDir, nil
+}
+
+// GetConfigPath returns the path to the configuration file
+func GetConfigPath() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+
 	return filepath.Join(configDir, "config.json"), nil
 }
 
@@ -184,4 +200,61 @@ func SetDefaultPatterns(patterns PatternConfig) error {
 
 	config.DefaultPatterns = patterns
 	return saveConfig(config)
-}
\ No newline at end of file
+}
+
+// ValidateVariableName checks that name can be used as a template variable
+func ValidateVariableName(name string) error {
+	if !variableName.MatchString(name) {
+		return fmt.Errorf("invalid variable name %q, use letters, digits and underscores", name)
+	}
+	return nil
+}
+
+// GetVariables returns the template variables saved in the configuration
+func GetVariables() (map[string]string, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string, len(config.Variables))
+	for name, value := range config.Variables {
+		result[name] = value
+	}
+
+	return result, nil
+}
+
+// SetVariable saves a template variable, replacing any previous value
+func SetVariable(name, value string) error {
+	if err := ValidateVariableName(name); err != nil {
+		return err
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	if config.Variables == nil {
+		config.Variables = make(map[string]string)
+	}
+	config.Variables[name] = value
+
+	return saveConfig(config)
+}
+
+// UnsetVariable removes a template variable from the configuration
+func UnsetVariable(name string) error {
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	if _, exists := config.Variables[name]; !exists {
+		return ErrVariableNotFound
+	}
+	delete(config.Variables, name)
+
+	return saveConfig(config)
+}
@@ -0,0 +1,343 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/rsvinicius/dotme/internal/alias"
+	"github.com/rsvinicius/dotme/internal/fs"
+)
+
+const (
+	manifestFile = "backup.json" // Name of the metadata file inside a backup set
+	filesDir     = "files"       // Name of the directory holding the original files inside a backup set
+	idLayout     = "20060102-150405"
+)
+
+// ErrNothingToUndo is returned by Latest when every backup set has been restored
+var ErrNothingToUndo = errors.New("no applied dotfiles to undo")
+
+// File describes a destination file written by an apply
+type File struct {
+	Path    string      `json:"path"`               // Destination file
+	Created bool        `json:"created,omitempty"`  // The file did not exist before the apply
+	Mode    os.FileMode `json:"mode,omitempty"`     // Permissions of the original file
+	Backup  string      `json:"backup,omitempty"`   // Copy of the original file, relative to the set directory
+	Link    bool        `json:"link,omitempty"`     // The apply replaced the file with a symbolic link
+	OldLink string      `json:"old_link,omitempty"` // Target of the original symbolic link, if the file was one
+}
+
+// Set is the backup of the destination files changed by a single apply
+type Set struct {
+	ID          string     `json:"id"`                     // Name of the set directory, derived from the creation time
+	Repo        string     `json:"repo"`                   // Repository the dotfiles were applied from
+	Revision    string     `json:"revision,omitempty"`     // Applied revision, including the commit
+	DestDir     string     `json:"dest_dir"`               // Directory the dotfiles were applied to
+	CreatedAt   time.Time  `json:"created_at"`             // Time of the apply
+	RestoredAt  *time.Time `json:"restored_at,omitempty"`  // Time of the last restore, if any
+	Files       []File     `json:"files"`                  // Files written, in order
+	CreatedDirs []string   `json:"created_dirs,omitempty"` // Directories created by the apply
+
+	Dir  string `json:"-"` // Directory of the backup set
+	Size int64  `json:"-"` // Disk usage of the backup set in bytes
+}
+
+// GetBackupDir returns the directory holding backup sets
+func GetBackupDir() (string, error) {
+	configDir, err := alias.GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	backupDir := filepath.Join(configDir, "backups")
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	return backupDir, nil
+}
+
+// New returns an empty backup set for an apply. Nothing is written to disk
+// until the first file is recorded.
+func New(repo, revision, destDir string) *Set {
+	return &Set{Repo: repo, Revision: revision, DestDir: destDir, CreatedAt: time.Now()}
+}
+
+// Record saves the original state of the destination file of an action
+// before it is written. It has the signature of fs.Journal.
+func (s *Set) Record(ctx context.Context, action *fs.FileAction) error {
+	if s.Dir == "" {
+		if err := s.create(); err != nil {
+			return err
+		}
+	}
+
+	file := File{Path: action.Dest, Link: action.Link != ""}
+	switch {
+	case action.Change == fs.ChangeCreate:
+		file.Created = true
+		// Remember the directories that writing the file creates
+		for dir := filepath.Dir(action.Dest); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+			if _, err := os.Lstat(dir); err == nil {
+				break
+			}
+			s.CreatedDirs = append(s.CreatedDirs, dir)
+		}
+	case action.OldLink != "":
+		file.OldLink = action.OldLink
+	default:
+		file.Mode = action.OldMode
+		file.Backup = filepath.ToSlash(filepath.Join(filesDir, strconv.Itoa(len(s.Files))))
+		if err := copyFile(ctx, action.Dest, filepath.Join(s.Dir, file.Backup), file.Mode); err != nil {
+			return err
+		}
+	}
+
+	s.Files = append(s.Files, file)
+	return s.save()
+}
+
+// create makes the directory of a new backup set, named after its creation time
+func (s *Set) create() error {
+	backupDir, err := GetBackupDir()
+	if err != nil {
+		return err
+	}
+
+	id := s.CreatedAt.Format(idLayout)
+	for i := 1; ; i++ {
+		err := os.Mkdir(filepath.Join(backupDir, id), 0755)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return fmt.Errorf("failed to create backup set: %w", err)
+		}
+		id = s.CreatedAt.Format(idLayout) + "-" + strconv.Itoa(i)
+	}
+
+	s.ID = id
+	s.Dir = filepath.Join(backupDir, id)
+	if err := os.Mkdir(filepath.Join(s.Dir, filesDir), 0755); err != nil {
+		return fmt.Errorf("failed to create backup set: %w", err)
+	}
+	return nil
+}
+
+// save writes the metadata of the backup set
+func (s *Set) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal backup set: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(s.Dir, manifestFile), data, 0644); err != nil {
+		return fmt.Errorf("failed to write backup set: %w", err)
+	}
+
+	return nil
+}
+
+// Restore reverts the apply recorded in the backup set: overwritten files get
+// their original content and mode back, and files and directories created by
+// the apply are removed
+func (s *Set) Restore() error {
+	ctx := context.Background()
+	for i := len(s.Files) - 1; i >= 0; i-- {
+		file := s.Files[i]
+		if file.Created {
+			if err := os.Remove(file.Path); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove %s: %w", file.Path, err)
+			}
+			fmt.Printf("🗑️  Removed: %s\n", file.Path)
+			continue
+		}
+
+		if file.OldLink != "" || file.Link {
+			// Remove the link written by the apply, never the file it points to
+			if err := os.Remove(file.Path); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove %s: %w", file.Path, err)
+			}
+		}
+		if file.OldLink != "" {
+			if err := os.Symlink(file.OldLink, file.Path); err != nil {
+				return fmt.Errorf("failed to restore link %s: %w", file.Path, err)
+			}
+			fmt.Printf("♻️  Restored: %s\n", file.Path)
+			continue
+		}
+
+		// Write through a symlinked destination like the apply did
+		target := file.Path
+		if resolved, err := filepath.EvalSymlinks(file.Path); err == nil {
+			target = resolved
+		}
+		if err := copyFile(ctx, filepath.Join(s.Dir, filepath.FromSlash(file.Backup)), target, file.Mode); err != nil {
+			return err
+		}
+		fmt.Printf("♻️  Restored: %s\n", file.Path)
+	}
+
+	// Remove nested directories before their parents, keeping those that
+	// still hold other files
+	dirs := append([]string(nil), s.CreatedDirs...)
+	sort.Slice(dirs, func(i, j int) bool { return len(dirs[i]) > len(dirs[j]) })
+	for _, dir := range dirs {
+		_ = os.Remove(dir)
+	}
+
+	now := time.Now()
+	s.RestoredAt = &now
+	return s.save()
+}
+
+// Discard removes the backup set, used when the apply it records was rolled back
+func (s *Set) Discard() error {
+	if s.Dir == "" {
+		return nil
+	}
+	if err := os.RemoveAll(s.Dir); err != nil {
+		return fmt.Errorf("failed to remove backup set %s: %w", s.ID, err)
+	}
+	s.ID, s.Dir = "", ""
+	return nil
+}
+
+// copyFile copies src to dst atomically with the given permissions
+func copyFile(ctx context.Context, src, dst string, mode os.FileMode) error {
+	source, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer source.Close()
+
+	if err := fs.WriteAtomic(ctx, dst, source, mode); err != nil {
+		return fmt.Errorf("failed to copy %s to %s: %w", src, dst, err)
+	}
+	return nil
+}
+
+// readSet loads the metadata of a backup set
+func readSet(setDir string) (*Set, error) {
+	data, err := os.ReadFile(filepath.Join(setDir, manifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup set: %w", err)
+	}
+
+	var set Set
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse backup set: %w", err)
+	}
+	set.Dir = setDir
+
+	return &set, nil
+}
+
+// List returns the backup sets, newest first. Sets without readable metadata
+// are skipped.
+func List() ([]*Set, error) {
+	backupDir, err := GetBackupDir()
+	if err != nil {
+		return nil, err
+	}
+
+	dirEntries, err := os.ReadDir(backupDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	var sets []*Set
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.IsDir() {
+			continue
+		}
+
+		set, err := readSet(filepath.Join(backupDir, dirEntry.Name()))
+		if err != nil {
+			continue
+		}
+		set.Size = dirSize(set.Dir)
+		sets = append(sets, set)
+	}
+
+	sort.Slice(sets, func(i, j int) bool {
+		return sets[i].CreatedAt.After(sets[j].CreatedAt)
+	})
+
+	return sets, nil
+}
+
+// Get returns the backup set with the given ID
+func Get(id string) (*Set, error) {
+	sets, err := List()
+	if err != nil {
+		return nil, err
+	}
+	for _, set := range sets {
+		if set.ID == id {
+			return set, nil
+		}
+	}
+	return nil, fmt.Errorf("backup set '%s' not found", id)
+}
+
+// Latest returns the most recent backup set that has not been restored
+func Latest() (*Set, error) {
+	sets, err := List()
+	if err != nil {
+		return nil, err
+	}
+	for _, set := range sets {
+		if set.RestoredAt == nil {
+			return set, nil
+		}
+	}
+	return nil, ErrNothingToUndo
+}
+
+// Prune removes backup sets created more than maxAge ago and returns the removed sets
+func Prune(maxAge time.Duration) ([]*Set, error) {
+	sets, err := List()
+	if err != nil {
+		return nil, err
+	}
+
+	var pruned []*Set
+	cutoff := time.Now().Add(-maxAge)
+	for _, set := range sets {
+		if set.CreatedAt.After(cutoff) {
+			continue
+		}
+		if err := os.RemoveAll(set.Dir); err != nil {
+			return pruned, fmt.Errorf("failed to remove backup set %s: %w", set.ID, err)
+		}
+		pruned = append(pruned, set)
+	}
+
+	return pruned, nil
+}
+
+// dirSize returns the total size of the regular files below dir
+func dirSize(dir string) int64 {
+	var size int64
+	_ = filepath.WalkDir(dir, func(_ string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
@@ -1,40 +1,226 @@
 package internal
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/rsvinicius/dotme/internal/alias"
+	"github.com/rsvinicius/dotme/internal/backup"
 	"github.com/rsvinicius/dotme/internal/fs"
 	"github.com/rsvinicius/dotme/internal/git"
 	"github.com/rsvinicius/dotme/internal/patterns"
+	"github.com/rsvinicius/dotme/internal/secret"
+	"github.com/rsvinicius/dotme/internal/source"
 )
 
-// ProcessRepository handles cloning the repository and copying dotfiles
-func ProcessRepository(repoURL string, includePatterns, excludePatterns []string) error {
-	// Clone the repository into a temporary directory
-	tempDir, err := git.CloneRepository(repoURL)
+// Options contains the settings used when applying dotfiles from a repository
+type Options struct {
+	Ref             string              // Branch, tag or commit to apply; empty uses the remote HEAD
+	FullClone       bool                // Clone the full history instead of a shallow clone
+	NoCache         bool                // Clone into a temporary directory instead of the cache
+	Offline         bool                // Apply the cached copy without contacting the remote
+	Path            string              // Subdirectory of the repository to scan for dotfiles
+	SSHKey          string              // Private key file used for SSH remotes
+	NoSubmodules    bool                // Skip initializing and checking out submodules
+	NoLFS           bool                // Refuse Git LFS pointer files instead of fetching their objects
+	DryRun          bool                // Report the changes without modifying the destination
+	Diff            bool                // Print a unified diff of each changed file before applying
+	Color           bool                // Color the printed diffs
+	ShowSecrets     bool                // Show decrypted content in the printed diffs
+	OnConflict      fs.ConflictStrategy // What happens to existing files with different content
+	Resolve         fs.ConflictResolver // Chooses the strategy per file with fs.ConflictPrompt
+	ConflictRules   []fs.ConflictRule   // Per-pattern conflict strategies, such as merging JSON settings
+	MergeArrays     fs.ArrayMerge       // How arrays in merged JSON files combine
+	Link            fs.LinkMode         // Symlink dotfiles from a persistent checkout instead of copying them
+	Alias           string              // Saved alias of the repository; names its checkout and managed blocks
+	Symlinks        fs.SymlinkPolicy    // How symbolic links in the repository are applied
+	Target          string              // Directory to apply the dotfiles to, with ~ expanded; empty uses the current directory
+	CreateTarget    bool                // Create the target directory when it does not exist
+	Vars            map[string]string   // Template variables, overriding those saved in the configuration
+	KeyFile         string              // Key file decrypting .enc files; empty falls back to DOTME_PASSPHRASE, ~/.dotme/key or a prompt
+	Verbose         bool                // Print details such as the authentication method
+	IncludePatterns []string            // Patterns of dotfiles to include
+	ExcludePatterns []string            // Patterns of dotfiles to exclude
+}
+
+// ProcessRepository handles cloning the repository and copying dotfiles. The
+// repository may also be a local directory, file:// URL or archive (see source.Parse).
+// Cancelling ctx stops the work in progress and removes temporary files.
+func ProcessRepository(ctx context.Context, repoURL string, options *Options) error {
+	if options == nil {
+		options = &Options{}
+	}
+
+	snapshot, destDir, err := openSnapshot(ctx, repoURL, options)
 	if err != nil {
 		return err
 	}
-	defer os.RemoveAll(tempDir)
+	defer snapshot.Close()
+
+	fmt.Println("📋 Scanning for dotfiles...")
+
+	// Record the original state of every written file so the apply can be undone
+	copyOpts := copyOptions(snapshot, repoURL, options)
+	set := backup.New(repoURL, snapshot.Revision, destDir)
+	if !options.DryRun {
+		copyOpts.Journal = set.Record
+	}
+
+	// Process files from the source directory
+	err = fs.CopyDotFiles(ctx, snapshot.Dir, destDir, copyOpts)
+	if err != nil && !errors.Is(err, fs.ErrPartialApply) {
+		// The destination was rolled back, so there is nothing to undo
+		if discardErr := set.Discard(); discardErr != nil {
+			fmt.Printf("⚠️  Warning: %s; delete %s so that 'dotme undo' does not revert the rolled back apply\n", discardErr, set.Dir)
+			return err
+		}
+	}
+	if set.ID != "" {
+		fmt.Printf("💾 Backup %s saved, run 'dotme undo' to revert these changes\n", set.ID)
+	}
+	return err
+}
+
+// DiffRepository prints a unified diff between the dotfiles of a repository
+// and the existing files in the destination directory without modifying them
+func DiffRepository(ctx context.Context, repoURL string, options *Options) error {
+	if options == nil {
+		options = &Options{}
+	}
 
-	// Get current working directory
-	destDir, err := os.Getwd()
+	snapshot, destDir, err := openSnapshot(ctx, repoURL, options)
 	if err != nil {
-		return fmt.Errorf("failed to get current working directory: %w", err)
+		return err
 	}
+	defer snapshot.Close()
 
-	fmt.Println("📋 Scanning for dotfiles...")
+	plan, err := fs.PlanDotFiles(ctx, snapshot.Dir, destDir, copyOptions(snapshot, repoURL, options))
+	if err != nil {
+		return err
+	}
+	defer plan.Close()
+
+	fmt.Println()
+	changed, err := fs.PrintDiffs(os.Stdout, plan.Actions, options.Color, options.ShowSecrets)
+	if err != nil {
+		return err
+	}
+
+	if changed == 0 {
+		fmt.Printf("\n✅ All %d files are up to date.\n", len(plan.Actions))
+		return nil
+	}
+	fmt.Printf("\n📊 %d of %d files differ.\n", changed, len(plan.Actions))
+	return nil
+}
+
+// openSnapshot opens the source of the dotfiles and returns it along with the destination directory
+func openSnapshot(ctx context.Context, repoURL string, options *Options) (*source.Snapshot, string, error) {
+	// Check the destination first so that nothing is cloned for a bad target
+	destDir, err := targetDir(options)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Linked dotfiles must outlive the run, so they point into a persistent checkout
+	var checkoutDir string
+	if options.Link != fs.LinkNone {
+		base, _ := source.SplitSubdir(repoURL)
+		var err error
+		if checkoutDir, err = git.CheckoutDir(base, options.Alias); err != nil {
+			return nil, "", err
+		}
+	}
+
+	// Clone, extract or open the source in place
+	snapshot, err := source.Open(ctx, repoURL, &source.Options{
+		Ref:          options.Ref,
+		FullClone:    options.FullClone,
+		NoCache:      options.NoCache,
+		Offline:      options.Offline,
+		Path:         options.Path,
+		SSHKey:       options.SSHKey,
+		NoSubmodules: options.NoSubmodules,
+		Verbose:      options.Verbose,
+		CheckoutDir:  checkoutDir,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	if samePath(snapshot.Dir, destDir) {
+		snapshot.Close()
+		return nil, "", fmt.Errorf("source and destination are the same directory: %s", destDir)
+	}
+
+	return snapshot, destDir, nil
+}
+
+// targetDir returns the absolute destination directory: the target when
+// given, otherwise the current directory. A missing target is only accepted
+// with CreateTarget, and is then created by the apply along with the files.
+func targetDir(options *Options) (string, error) {
+	if options.Target == "" {
+		destDir, err := os.Getwd()
+		if err != nil {
+			return "", fmt.Errorf("failed to get current working directory: %w", err)
+		}
+		return destDir, nil
+	}
+
+	target, err := expandHome(options.Target)
+	if err != nil {
+		return "", err
+	}
+	destDir, err := filepath.Abs(target)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve target directory %s: %w", options.Target, err)
+	}
+
+	info, err := os.Stat(destDir)
+	switch {
+	case os.IsNotExist(err) && options.CreateTarget:
+		fmt.Printf("📁 Target directory %s will be created\n", destDir)
+	case os.IsNotExist(err):
+		return "", fmt.Errorf("target directory %s does not exist, use --create-target to create it", destDir)
+	case err != nil:
+		return "", fmt.Errorf("failed to access target directory %s: %w", destDir, err)
+	case !info.IsDir():
+		return "", fmt.Errorf("target %s is not a directory", destDir)
+	}
+
+	fmt.Printf("🎯 Applying to %s\n", destDir)
+	return destDir, nil
+}
+
+// expandHome replaces a leading ~ in path with the home directory of the current user
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") && !strings.HasPrefix(path, "~"+string(filepath.Separator)) {
+		return path, nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, path[1:]), nil
+}
 
+// copyOptions builds the copy options for a snapshot, loading the default
+// patterns when no patterns are given
+func copyOptions(snapshot *source.Snapshot, repoURL string, options *Options) *fs.CopyOptions {
 	// Create filter options
 	filterOptions := &patterns.FilterOptions{
-		IncludePatterns: includePatterns,
-		ExcludePatterns: excludePatterns,
+		IncludePatterns: options.IncludePatterns,
+		ExcludePatterns: options.ExcludePatterns,
 	}
 
 	// If no patterns provided via command line, try to load defaults from config
-	if len(includePatterns) == 0 && len(excludePatterns) == 0 {
+	if len(options.IncludePatterns) == 0 && len(options.ExcludePatterns) == 0 {
 		defaultPatterns, err := alias.GetDefaultPatterns()
 		if err == nil {
 			filterOptions.IncludePatterns = defaultPatterns.IncludePatterns
@@ -43,6 +229,54 @@ func ProcessRepository(repoURL string, includePatterns, excludePatterns []string
 		// If error loading defaults, continue with empty patterns (default behavior)
 	}
 
-	// Process files from the temporary directory
-	return fs.CopyDotFiles(tempDir, destDir, filterOptions)
-}
\ No newline at end of file
+	// Git LFS pointer files are refused when fetching is disabled
+	lfs := snapshot.LFS
+	if options.NoLFS {
+		lfs = nil
+	}
+
+	return &fs.CopyOptions{
+		Filter:      filterOptions,
+		Revision:    snapshot.Revision,
+		LFS:         lfs,
+		DryRun:      options.DryRun,
+		Diff:        options.Diff,
+		Color:       options.Color,
+		ShowSecrets: options.ShowSecrets,
+
+		OnConflict:    options.OnConflict,
+		Resolve:       options.Resolve,
+		ConflictRules: options.ConflictRules,
+		MergeArrays:   options.MergeArrays,
+		BlockName:     blockName(repoURL, options.Alias),
+		Link:          options.Link,
+		Symlinks:      options.Symlinks,
+		Root:          snapshot.Root,
+
+		TemplateData: templateData(options.Vars),
+		Decrypt:      secret.NewDecrypter(options.KeyFile),
+	}
+}
+
+// blockName returns the name of the managed blocks written for a repository:
+// the alias when one is used, otherwise the name of the repository
+func blockName(repoURL, aliasName string) string {
+	if aliasName != "" {
+		return strings.Join(strings.Fields(aliasName), "-")
+	}
+	base, _ := source.SplitSubdir(repoURL)
+	return git.RepoName(base)
+}
+
+// samePath reports whether two paths refer to the same directory
+func samePath(a, b string) bool {
+	aInfo, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bInfo, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(aInfo, bInfo)
+}
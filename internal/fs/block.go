@@ -0,0 +1,84 @@
+package fs
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// blockMarkers returns the lines opening and closing the managed block name
+func blockMarkers(name string) (string, string) {
+	return "# >>> dotme:" + name + " >>>", "# <<< dotme:" + name + " <<<"
+}
+
+// WriteBlock returns existing with content placed in the managed block name,
+// delimited by # >>> dotme:<name> >>> and # <<< dotme:<name> <<< lines. An
+// existing block is replaced in place; otherwise the block is appended after
+// a blank line. The rest of the file is kept as is.
+func WriteBlock(existing, content []byte, name string) ([]byte, error) {
+	if name == "" || strings.ContainsAny(name, " \t\r\n>") {
+		return nil, fmt.Errorf("invalid managed block name %q", name)
+	}
+	begin, end := blockMarkers(name)
+
+	eol := "\n"
+	if bytes.Contains(existing, []byte("\r\n")) {
+		eol = "\r\n"
+	}
+	for _, line := range trimmedLines(content) {
+		if line == begin || line == end {
+			return nil, fmt.Errorf("the content contains the markers of the managed block %s", name)
+		}
+	}
+
+	var block strings.Builder
+	block.WriteString(begin + eol)
+	block.Write(content)
+	if len(content) > 0 && !bytes.HasSuffix(content, []byte("\n")) {
+		block.WriteString(eol)
+	}
+	block.WriteString(end + eol)
+
+	// Find the marker lines of an existing block
+	lines := splitLines(string(existing))
+	beginLine, endLine := -1, -1
+	for i, line := range lines {
+		switch strings.TrimRight(line, " \t\r\n") {
+		case begin:
+			if beginLine >= 0 {
+				return nil, fmt.Errorf("the managed block %s is opened twice", name)
+			}
+			beginLine = i
+		case end:
+			if endLine >= 0 {
+				return nil, fmt.Errorf("the managed block %s has more than one end marker", name)
+			}
+			if beginLine < 0 {
+				return nil, fmt.Errorf("the managed block %s is closed before it is opened", name)
+			}
+			endLine = i
+		}
+	}
+
+	var out strings.Builder
+	switch {
+	case beginLine >= 0 && endLine < 0:
+		return nil, fmt.Errorf("the managed block %s is never closed", name)
+	case beginLine >= 0:
+		out.WriteString(strings.Join(lines[:beginLine], ""))
+		out.WriteString(block.String())
+		out.WriteString(strings.Join(lines[endLine+1:], ""))
+	case len(existing) == 0:
+		out.WriteString(block.String())
+	default:
+		out.Write(existing)
+		if !bytes.HasSuffix(existing, []byte("\n")) {
+			out.WriteString(eol)
+		}
+		if last := lines[len(lines)-1]; strings.TrimSpace(last) != "" {
+			out.WriteString(eol)
+		}
+		out.WriteString(block.String())
+	}
+	return []byte(out.String()), nil
+}
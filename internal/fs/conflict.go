@@ -0,0 +1,151 @@
+package fs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ConflictStrategy decides what happens to destination files that exist with different content
+type ConflictStrategy string
+
+const (
+	ConflictOverwrite ConflictStrategy = "overwrite" // Replace the existing file
+	ConflictSkip      ConflictStrategy = "skip"      // Keep the existing file
+	ConflictBackup    ConflictStrategy = "backup"    // Copy the existing file to a .bak file, then replace it
+	ConflictPrompt    ConflictStrategy = "prompt"    // Ask for each conflicting file
+	ConflictFail      ConflictStrategy = "fail"      // Copy nothing if any file conflicts
+	ConflictMerge     ConflictStrategy = "merge"     // Merge the incoming content into the existing file, only selected by rules
+	ConflictBlock     ConflictStrategy = "block"     // Write the incoming content into a managed block of the file, only selected by rules
+)
+
+// ruleExamples holds an example pattern for each strategy that is only selected by rules
+var ruleExamples = map[ConflictStrategy]string{
+	ConflictMerge: ".vscode/*.json",
+	ConflictBlock: ".bashrc",
+}
+
+// ConflictStrategies lists the accepted conflict strategies
+var ConflictStrategies = []ConflictStrategy{ConflictOverwrite, ConflictSkip, ConflictBackup, ConflictPrompt, ConflictFail}
+
+// ParseConflictStrategy parses the name of a conflict strategy, defaulting to overwrite when empty
+func ParseConflictStrategy(name string) (ConflictStrategy, error) {
+	if name == "" {
+		return ConflictOverwrite, nil
+	}
+	for _, strategy := range ConflictStrategies {
+		if string(strategy) == name {
+			return strategy, nil
+		}
+	}
+	if example, ok := ruleExamples[ConflictStrategy(name)]; ok {
+		return "", fmt.Errorf("the %s strategy only applies to selected files, use %s:<pattern> such as %s:%s", name, name, name, example)
+	}
+
+	names := make([]string, len(ConflictStrategies))
+	for i, strategy := range ConflictStrategies {
+		names[i] = string(strategy)
+	}
+	return "", fmt.Errorf("invalid conflict strategy %q, expected one of %s", name, strings.Join(names, ", "))
+}
+
+// ConflictResolver chooses the strategy for a single conflicting file when
+// the prompt strategy is used. Returning ConflictFail aborts the copy.
+type ConflictResolver func(action *FileAction) (ConflictStrategy, error)
+
+// Outcome records what applying did to a destination file
+type Outcome int
+
+const (
+	OutcomePending     Outcome = iota // The action has not been applied
+	OutcomeCreated                    // The file did not exist and was written
+	OutcomeOverwritten                // The existing file was replaced
+	OutcomeUnchanged                  // The existing file already matched
+	OutcomeSkipped                    // The existing file was kept
+	OutcomeBackedUp                   // The existing file was backed up and replaced
+	OutcomeMerged                     // The incoming content was merged into the existing file
+)
+
+// String returns the name of the outcome shown in reports
+func (o Outcome) String() string {
+	switch o {
+	case OutcomeCreated:
+		return "created"
+	case OutcomeOverwritten:
+		return "overwritten"
+	case OutcomeUnchanged:
+		return "unchanged"
+	case OutcomeSkipped:
+		return "skipped"
+	case OutcomeBackedUp:
+		return "backed up"
+	case OutcomeMerged:
+		return "merged"
+	default:
+		return "pending"
+	}
+}
+
+// conflictError lists the conflicting files refused by the fail strategy
+func conflictError(actions []*FileAction, options *CopyOptions) error {
+	var conflicts []string
+	for _, action := range actions {
+		if action.Change == ChangeOverwrite && strategyFor(action.Path, options.ConflictRules, options.OnConflict) == ConflictFail {
+			conflicts = append(conflicts, action.Path)
+		}
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d files already exist with different content, nothing was copied:\n   - %s",
+		len(conflicts), strings.Join(conflicts, "\n   - "))
+}
+
+// stageBackup stages a copy of the existing destination file of an action
+// next to it. The backup is journaled as a created file, so undoing the apply
+// removes it.
+func stageBackup(ctx context.Context, t *transaction, action *FileAction, journal Journal) error {
+	backup := action.Dest + ".bak"
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(backup); os.IsNotExist(err) {
+			break
+		}
+		backup = action.Dest + ".bak." + strconv.Itoa(i)
+	}
+
+	if journal != nil {
+		created := &FileAction{
+			Path:   action.Path + strings.TrimPrefix(backup, action.Dest),
+			Src:    action.Dest,
+			Dest:   backup,
+			Change: ChangeCreate,
+			Mode:   action.OldMode,
+		}
+		if err := journal(ctx, created); err != nil {
+			return fmt.Errorf("failed to record the backup of %s: %w", action.Dest, err)
+		}
+	}
+
+	// Existing links are backed up as links
+	if action.OldLink != "" {
+		if err := t.stageLink(backup, action.OldLink); err != nil {
+			return fmt.Errorf("failed to back up %s: %w", action.Dest, err)
+		}
+		action.Backup = backup
+		return nil
+	}
+
+	existing, err := os.Open(action.Dest)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", action.Dest, err)
+	}
+	defer existing.Close()
+
+	if err := t.stage(backup, existing, action.OldMode); err != nil {
+		return fmt.Errorf("failed to back up %s: %w", action.Dest, err)
+	}
+	action.Backup = backup
+	return nil
+}
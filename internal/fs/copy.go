@@ -1,6 +1,7 @@
 package fs
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -9,66 +10,106 @@ import (
 	"github.com/rsvinicius/dotme/internal/patterns"
 )
 
-// CopyDotFiles copies dotfiles from source to destination directory based on filter options
-func CopyDotFiles(srcDir, destDir string, filterOptions *patterns.FilterOptions) error {
-	var copied, ignored int
-	var copiedItems []string
-	var ignoredItems []string
+// CopyOptions contains the options that control how dotfiles are copied
+type CopyOptions struct {
+	Filter      *patterns.FilterOptions // Include/exclude filtering of root entries
+	Revision    string                  // Description of the applied revision shown in the summary
+	LFS         LFSFetcher              // Fetches Git LFS objects; pointer files are refused when nil
+	DryRun      bool                    // Report the changes without modifying the destination
+	Diff        bool                    // Print a unified diff of each changed file before applying
+	Color       bool                    // Color the printed diffs
+	ShowSecrets bool                    // Show decrypted content in the printed diffs
 
-	// Read all files and directories from the source
-	entries, err := os.ReadDir(srcDir)
-	if err != nil {
-		return fmt.Errorf("failed to read source directory: %w", err)
-	}
+	// OnConflict decides what happens to existing files with different content;
+	// empty overwrites them. Resolve is asked for each file with ConflictPrompt.
+	OnConflict ConflictStrategy
+	Resolve    ConflictResolver
 
-	// Process each entry
-	for _, entry := range entries {
-		name := entry.Name()
+	// ConflictRules override OnConflict for the files they match, the last
+	// matching rule winning. MergeArrays selects how merged JSON arrays combine.
+	ConflictRules []ConflictRule
+	MergeArrays   ArrayMerge
 
-		// Skip .git directory
-		if name == ".git" {
-			continue
-		}
+	// BlockName names the managed blocks written by the block strategy, usually the alias
+	BlockName string
 
-		// Check if the file should be included based on filter options
-		if !filterOptions.ShouldInclude(name) {
-			ignored++
-			ignoredItems = append(ignoredItems, name)
-			continue
-		}
+	// Link replaces destination files with symbolic links to the source instead of copying them
+	Link LinkMode
 
-		srcPath := filepath.Join(srcDir, name)
-		destPath := filepath.Join(destDir, name)
+	// TemplateData is the data .tmpl files are rendered with
+	TemplateData map[string]any
 
-		if entry.IsDir() {
-			// Process directories recursively
-			if err := CopyDir(srcPath, destPath); err != nil {
-				return err
-			}
-			copied++
-			copiedItems = append(copiedItems, name+"/")
-		} else {
-			// Copy files directly
-			if err := CopyFile(srcPath, destPath); err != nil {
-				return err
-			}
-			copied++
-			copiedItems = append(copiedItems, name)
+	// Decrypt decrypts .enc files, which are refused when nil
+	Decrypt Decrypter
+
+	// Symlinks selects how symbolic links in the source are applied; empty
+	// follows them. Links may only point inside Root, which defaults to the
+	// source directory.
+	Symlinks SymlinkPolicy
+	Root     string
+
+	// Journal is called before each file is written, while the destination still holds its original content
+	Journal Journal
+}
+
+// Journal records the original state of a destination file before it is written
+type Journal func(ctx context.Context, action *FileAction) error
+
+// CopyDotFiles copies dotfiles from source to destination directory based on
+// the copy options. Files are written atomically, so cancelling ctx never
+// leaves a partially written file behind.
+func CopyDotFiles(ctx context.Context, srcDir, destDir string, options *CopyOptions) error {
+	if options == nil {
+		options = &CopyOptions{}
+	}
+	filterOptions := options.Filter
+	if filterOptions == nil {
+		filterOptions = &patterns.FilterOptions{}
+	}
+
+	plan, err := PlanDotFiles(ctx, srcDir, destDir, options)
+	if err != nil {
+		return err
+	}
+	defer plan.Close()
+
+	if options.Diff {
+		fmt.Println()
+		if _, err := PrintDiffs(os.Stdout, plan.Actions, options.Color, options.ShowSecrets); err != nil {
+			return err
+		}
+	}
+
+	if options.DryRun {
+		printDryRun(plan.Actions, options)
+	} else {
+		if err := apply(ctx, plan.Actions, options); err != nil {
+			return err
 		}
 	}
 
 	// Display summary
 	fmt.Printf("\n📦 Summary:\n")
-	fmt.Printf("✅ Copied %d items:\n", copied)
-	for _, item := range copiedItems {
+	if options.Revision != "" {
+		fmt.Printf("📌 Revision: %s\n", options.Revision)
+	}
+	fmt.Printf("✅ Selected %d items:\n", len(plan.Selected))
+	for _, item := range plan.Selected {
 		fmt.Printf("   - %s\n", item)
 	}
 
-	fmt.Printf("\n❌ Ignored %d items:\n", ignored)
-	for _, item := range ignoredItems {
+	fmt.Printf("\n❌ Ignored %d items:\n", len(plan.Ignored))
+	for _, item := range plan.Ignored {
 		fmt.Printf("   - %s\n", item)
 	}
 
+	if len(plan.Skipped) > 0 {
+		fmt.Printf("\n⏭️  Skipped %d symbolic links:\n", len(plan.Skipped))
+		for _, item := range plan.Skipped {
+			fmt.Printf("   - %s\n", item)
+		}
+	}
+
 	// Display active filters if any
 	if len(filterOptions.IncludePatterns) > 0 || len(filterOptions.ExcludePatterns) > 0 {
 		fmt.Printf("\n🔍 Active filters:\n")
@@ -80,74 +121,292 @@ func CopyDotFiles(srcDir, destDir string, filterOptions *patterns.FilterOptions)
 		}
 	}
 
+	if !options.DryRun {
+		printOutcomes(plan.Actions)
+	}
+
+	if options.DryRun {
+		fmt.Printf("\n🔍 Dry run complete, no files were changed.\n")
+		return nil
+	}
 	fmt.Printf("\n🎉 Done! Your dotfiles have been applied successfully.\n")
 
 	return nil
 }
 
-// CopyDir recursively copies a directory
-func CopyDir(src, dst string) error {
-	// Create destination directory if it doesn't exist
-	if err := os.MkdirAll(dst, os.ModePerm); err != nil {
-		return fmt.Errorf("failed to create directory %s: %w", dst, err)
+// PlanDotFiles determines the effect of copying the dotfiles from source to
+// destination without modifying the destination. The returned plan must be
+// closed to release fetched Git LFS objects.
+func PlanDotFiles(ctx context.Context, srcDir, destDir string, options *CopyOptions) (*Plan, error) {
+	if options == nil {
+		options = &CopyOptions{}
+	}
+	filterOptions := options.Filter
+	if filterOptions == nil {
+		filterOptions = &patterns.FilterOptions{}
 	}
 
-	entries, err := os.ReadDir(src)
+	// Read all files and directories from the source
+	entries, err := os.ReadDir(srcDir)
 	if err != nil {
-		return fmt.Errorf("failed to read directory %s: %w", src, err)
+		return nil, fmt.Errorf("failed to read source directory: %w", err)
 	}
 
+	// Select the entries to copy
+	plan := &Plan{}
+	var selected []os.DirEntry
+	var selectedPaths []string
 	for _, entry := range entries {
-		srcPath := filepath.Join(src, entry.Name())
-		dstPath := filepath.Join(dst, entry.Name())
+		name := entry.Name()
+
+		// Skip .git directory
+		if name == ".git" {
+			continue
+		}
+
+		// Check if the file should be included based on filter options
+		if !filterOptions.ShouldInclude(name) {
+			plan.Ignored = append(plan.Ignored, name)
+			continue
+		}
+
+		selected = append(selected, entry)
+		selectedPaths = append(selectedPaths, filepath.Join(srcDir, name))
+	}
+
+	root, err := sourceRoot(srcDir, options.Root)
+	if err != nil {
+		return nil, err
+	}
 
+	// Fetch Git LFS objects up front so that nothing is copied if one is
+	// missing. Links can only point to pointer files, so those are refused.
+	fetch := options.LFS
+	if options.Link != LinkNone {
+		fetch = nil
+	}
+	follow := options.Symlinks == SymlinksFollow || options.Symlinks == ""
+	plan.lfs, err = fetchLFSObjects(ctx, srcDir, root, follow, selectedPaths, fetch)
+	if err != nil {
+		return nil, err
+	}
+	p := &planner{
+		ctx:       ctx,
+		destDir:   destDir,
+		lfs:       plan.lfs,
+		link:      options.Link,
+		symlinks:  options.Symlinks,
+		root:      root,
+		data:      options.TemplateData,
+		decrypt:   options.Decrypt,
+		rules:     options.ConflictRules,
+		arrays:    options.MergeArrays,
+		blockName: options.BlockName,
+	}
+	for _, entry := range selected {
+		name := entry.Name()
+		if err := p.planRoot(filepath.Join(srcDir, name), filepath.Join(destDir, name)); err != nil {
+			plan.Close()
+			return nil, err
+		}
 		if entry.IsDir() {
-			if err := CopyDir(srcPath, dstPath); err != nil {
-				return err
-			}
+			plan.Selected = append(plan.Selected, name+"/")
 		} else {
-			if err := CopyFile(srcPath, dstPath); err != nil {
-				return err
+			plan.Selected = append(plan.Selected, name)
+		}
+	}
+	plan.Actions = p.actions
+	plan.Skipped = p.skipped
+	warnDanglingLinks(plan.Actions)
+
+	return plan, nil
+}
+
+// CopyDir recursively copies a directory, resolving conflicts with existing
+// files according to the OnConflict and Resolve options
+func CopyDir(src, dst string, options *CopyOptions) error {
+	return copyPath(src, dst, options)
+}
+
+// CopyFile copies a file from source to destination, resolving a conflict
+// with an existing file according to the OnConflict and Resolve options
+func CopyFile(src, dst string, options *CopyOptions) error {
+	return copyPath(src, dst, options)
+}
+
+// copyPath copies a file or directory from source to destination
+func copyPath(src, dst string, options *CopyOptions) error {
+	if options == nil {
+		options = &CopyOptions{}
+	}
+	ctx := context.Background()
+	root, err := sourceRoot(src, options.Root)
+	if err != nil {
+		return err
+	}
+	p := &planner{
+		ctx:       ctx,
+		destDir:   filepath.Dir(dst),
+		link:      options.Link,
+		symlinks:  options.Symlinks,
+		root:      root,
+		data:      options.TemplateData,
+		decrypt:   options.Decrypt,
+		rules:     options.ConflictRules,
+		arrays:    options.MergeArrays,
+		blockName: options.BlockName,
+	}
+	if err := p.planRoot(src, dst); err != nil {
+		return err
+	}
+	return apply(ctx, p.actions, options)
+}
+
+// apply writes the files of the given actions into the destination, skipping
+// files that are already up to date and resolving conflicts with existing
+// files according to the conflict strategy. Every file is staged first and
+// committed only once all of them succeeded; on any error, including an
+// aborted prompt, the destination is rolled back to its original state. The
+// fail strategy checks every action before anything is staged.
+func apply(ctx context.Context, actions []*FileAction, options *CopyOptions) error {
+	if err := conflictError(actions, options); err != nil {
+		return err
+	}
+
+	t := &transaction{ctx: ctx}
+	var staged []*FileAction
+	outcomes := map[*FileAction]Outcome{}
+	for _, action := range actions {
+		if err := ctx.Err(); err != nil {
+			return t.abort(err)
+		}
+
+		outcome := OutcomeCreated
+		switch action.Change {
+		case ChangeUnchanged:
+			action.Outcome = OutcomeUnchanged
+			fmt.Printf("✔️  Unchanged: %s\n", action.Dest)
+			continue
+		case ChangeOverwrite:
+			choice := strategyFor(action.Path, options.ConflictRules, options.OnConflict)
+			if choice == ConflictPrompt {
+				if options.Resolve == nil {
+					return t.abort(fmt.Errorf("cannot prompt for %s: no conflict resolver configured", action.Dest))
+				}
+				var err error
+				if choice, err = options.Resolve(action); err != nil {
+					return t.abort(err)
+				}
 			}
+
+			switch choice {
+			case ConflictSkip:
+				action.Outcome = OutcomeSkipped
+				fmt.Printf("⏭️  Skipped: %s already exists\n", action.Dest)
+				continue
+			case ConflictFail:
+				return t.abort(fmt.Errorf("aborted at %s, nothing was copied", action.Path))
+			case ConflictBackup:
+				outcome = OutcomeBackedUp
+			case ConflictMerge, ConflictBlock:
+				outcome = OutcomeMerged
+			default:
+				outcome = OutcomeOverwritten
+				fmt.Printf("⚠️  Warning: %s already exists, overwriting\n", action.Dest)
+			}
+		}
+
+		if options.Journal != nil {
+			if err := options.Journal(ctx, action); err != nil {
+				return t.abort(fmt.Errorf("failed to record the original state of %s: %w", action.Dest, err))
+			}
+		}
+		if outcome == OutcomeBackedUp {
+			if err := stageBackup(ctx, t, action, options.Journal); err != nil {
+				return t.abort(err)
+			}
+		}
+		if err := stageFile(t, action); err != nil {
+			return t.abort(err)
 		}
+		staged = append(staged, action)
+		outcomes[action] = outcome
 	}
 
+	if err := t.commit(); err != nil {
+		return err
+	}
+
+	for _, action := range staged {
+		action.Outcome = outcomes[action]
+		if action.Backup != "" {
+			fmt.Printf("💾 Backed up: %s → %s\n", action.Dest, action.Backup)
+		}
+		if action.Link != "" {
+			fmt.Printf("🔗 Linked: %s → %s\n", action.Dest, action.Link)
+			continue
+		}
+		if action.Outcome == OutcomeMerged {
+			fmt.Printf("🔀 Merged: %s\n", action.Dest)
+			continue
+		}
+		fmt.Printf("📄 Copied: %s\n", action.Dest)
+	}
 	return nil
 }
 
-// CopyFile copies a file from source to destination
-func CopyFile(src, dst string) error {
-	// Check if destination file exists
-	if _, err := os.Stat(dst); err == nil {
-		fmt.Printf("⚠️  Warning: %s already exists, overwriting\n", dst)
+// stageFile stages the content of an action for its destination, keeping the
+// mode of the source, or the symbolic link replacing the destination
+func stageFile(t *transaction, action *FileAction) error {
+	if action.Link != "" {
+		if err := t.stageLink(action.Dest, action.Link); err != nil {
+			return fmt.Errorf("failed to link %s to %s: %w", action.Dest, action.Link, err)
+		}
+		return nil
 	}
 
-	// Open source file
-	sourceFile, err := os.Open(src)
+	// Open source file, the fetched object of a Git LFS pointer or the generated content
+	sourceFile, err := action.open()
 	if err != nil {
-		return fmt.Errorf("failed to open source file %s: %w", src, err)
+		return fmt.Errorf("failed to open source file %s: %w", action.Src, err)
 	}
 	defer sourceFile.Close()
 
-	// Get source file mode
-	sourceInfo, err := sourceFile.Stat()
-	if err != nil {
-		return fmt.Errorf("failed to get source file info %s: %w", src, err)
+	// Write through a symlinked destination instead of replacing the link
+	target := action.Dest
+	if resolved, err := filepath.EvalSymlinks(action.Dest); err == nil {
+		target = resolved
 	}
 
-	// Create destination file
-	destFile, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, sourceInfo.Mode())
-	if err != nil {
-		return fmt.Errorf("failed to create destination file %s: %w", dst, err)
+	if err := t.stage(target, sourceFile, action.Mode); err != nil {
+		return fmt.Errorf("failed to copy file content from %s to %s: %w", action.Src, action.Dest, err)
 	}
-	defer destFile.Close()
+	return nil
+}
 
-	// Copy content
-	_, err = io.Copy(destFile, sourceFile)
+// WriteAtomic writes the content of r to a temporary file next to path and
+// renames it into place, so that path never holds partially written content
+func WriteAtomic(ctx context.Context, path string, r io.Reader, mode os.FileMode) error {
+	temp, err := writeTemp(ctx, path, r, mode)
 	if err != nil {
-		return fmt.Errorf("failed to copy file content from %s to %s: %w", src, dst, err)
+		return err
+	}
+	if err := os.Rename(temp, path); err != nil {
+		os.Remove(temp)
+		return err
 	}
-
-	fmt.Printf("📄 Copied: %s\n", dst)
 	return nil
-}
\ No newline at end of file
+}
+
+// contextReader stops reading once its context is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
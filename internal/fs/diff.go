@@ -0,0 +1,300 @@
+package fs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// diffContextLines is the number of unchanged lines shown around each change
+const diffContextLines = 3
+
+// binarySniffSize is the number of leading bytes checked for NUL bytes to detect binary files
+const binarySniffSize = 8000
+
+// linkMode is the mode git shows for symbolic links
+const linkMode = "120000"
+
+// ANSI escape sequences used for colored diffs
+const (
+	colorReset = "\x1b[0m"
+	colorBold  = "\x1b[1m"
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorCyan  = "\x1b[36m"
+)
+
+// diffOp is a line of an edit script: ' ' for unchanged, '-' for removed and '+' for added lines
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// PrintDiffs writes the diffs of all actions that change the destination and
+// returns the number of files that differ. Decrypted content is only shown
+// when showSecrets is set.
+func PrintDiffs(w io.Writer, actions []*FileAction, color, showSecrets bool) (int, error) {
+	changed := 0
+	for _, action := range actions {
+		if action.Change == ChangeUnchanged {
+			continue
+		}
+		changed++
+		if err := WriteDiff(w, action, color, showSecrets); err != nil {
+			return changed, err
+		}
+	}
+	return changed, nil
+}
+
+// WriteDiff writes a unified diff between the existing destination file (a/)
+// and the incoming content (b/) of an action. Binary files are reported
+// without their content and mode changes are shown like git does. Decrypted
+// secrets are reported by the hashes of their content unless showSecrets is set.
+func WriteDiff(w io.Writer, action *FileAction, color, showSecrets bool) error {
+	paint := func(code, text string) string {
+		if !color {
+			return text
+		}
+		return code + text + colorReset
+	}
+
+	newData, newMode, err := newSide(action)
+	if err != nil {
+		return err
+	}
+	var oldData []byte
+	oldMode := fmt.Sprintf("%04o", action.OldMode)
+	switch {
+	case action.OldLink != "":
+		oldData, oldMode = []byte(action.OldLink), linkMode
+	case action.Change != ChangeCreate:
+		oldData, err = os.ReadFile(action.Dest)
+		if err != nil {
+			return fmt.Errorf("failed to read destination file %s: %w", action.Dest, err)
+		}
+	}
+
+	var out strings.Builder
+	out.WriteString(paint(colorBold, fmt.Sprintf("diff a/%s b/%s", action.Path, action.Path)) + "\n")
+	oldName := "a/" + action.Path
+	if action.Change == ChangeCreate {
+		oldName = "/dev/null"
+		out.WriteString(paint(colorBold, "new file mode "+newMode) + "\n")
+	} else if newMode != oldMode {
+		out.WriteString(paint(colorBold, "old mode "+oldMode) + "\n")
+		out.WriteString(paint(colorBold, "new mode "+newMode) + "\n")
+	}
+
+	switch {
+	case bytes.Equal(oldData, newData) && action.Change != ChangeCreate:
+		// Only the mode differs
+	case action.Secret && !showSecrets && action.Change == ChangeCreate:
+		out.WriteString(fmt.Sprintf("Secret file b/%s added (%s), use --show-secrets to show it\n",
+			action.Path, contentHash(newData)))
+	case action.Secret && !showSecrets:
+		out.WriteString(fmt.Sprintf("Secret file b/%s changed (%s → %s), use --show-secrets to show the diff\n",
+			action.Path, contentHash(oldData), contentHash(newData)))
+	case isBinary(oldData) || isBinary(newData):
+		out.WriteString(fmt.Sprintf("Binary files %s and b/%s differ (%s → %s)\n",
+			oldName, action.Path, FormatSize(int64(len(oldData))), FormatSize(int64(len(newData)))))
+	default:
+		out.WriteString(paint(colorBold, "--- "+oldName) + "\n")
+		out.WriteString(paint(colorBold, "+++ b/"+action.Path) + "\n")
+		writeHunks(&out, diffLines(splitLines(string(oldData)), splitLines(string(newData))), paint)
+	}
+
+	_, err = io.WriteString(w, out.String())
+	return err
+}
+
+// newSide returns the incoming content of an action and its mode. Like in
+// git, the content of a symbolic link is its target.
+func newSide(action *FileAction) ([]byte, string, error) {
+	if action.Link != "" {
+		return []byte(action.Link), linkMode, nil
+	}
+	data, err := action.read()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read source file %s: %w", action.Src, err)
+	}
+	return data, fmt.Sprintf("%04o", action.Mode), nil
+}
+
+// contentHash returns a short SHA-256 of data, identifying a secret without revealing it
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:6])
+}
+
+// isBinary reports whether data looks like binary content
+func isBinary(data []byte) bool {
+	if len(data) > binarySniffSize {
+		data = data[:binarySniffSize]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+// splitLines splits text into lines that keep their line terminator
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines computes the shortest edit script turning a into b with the Myers algorithm
+func diffLines(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	max := n + m
+	if max == 0 {
+		return nil
+	}
+
+	offset := max
+	v := make([]int, 2*max+2)
+	var trace [][]int
+
+search:
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// Walk the trace backwards to recover the edit script
+	var ops []diffOp
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			ops = append(ops, diffOp{' ', a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, diffOp{'+', b[y-1]})
+			} else {
+				ops = append(ops, diffOp{'-', a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// writeHunks writes the edit script as unified diff hunks with context lines
+func writeHunks(out *strings.Builder, ops []diffOp, paint func(code, text string) string) {
+	for start := 0; start < len(ops); {
+		// Find the next change
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			return
+		}
+
+		// Extend the hunk while changes are close enough to share context
+		last := first
+		for i := first; i < len(ops); i++ {
+			if ops[i].kind != ' ' {
+				if i-last > 2*diffContextLines {
+					break
+				}
+				last = i
+			}
+		}
+
+		from := first - diffContextLines
+		if from < start {
+			from = start
+		}
+		to := last + diffContextLines + 1
+		if to > len(ops) {
+			to = len(ops)
+		}
+
+		// Line numbers of the hunk start in the old and new files
+		oldLine, newLine := 1, 1
+		for _, op := range ops[:from] {
+			if op.kind != '+' {
+				oldLine++
+			}
+			if op.kind != '-' {
+				newLine++
+			}
+		}
+		oldCount, newCount := 0, 0
+		for _, op := range ops[from:to] {
+			if op.kind != '+' {
+				oldCount++
+			}
+			if op.kind != '-' {
+				newCount++
+			}
+		}
+		if oldCount == 0 {
+			oldLine--
+		}
+		if newCount == 0 {
+			newLine--
+		}
+
+		out.WriteString(paint(colorCyan, fmt.Sprintf("@@ -%d,%d +%d,%d @@", oldLine, oldCount, newLine, newCount)) + "\n")
+		for _, op := range ops[from:to] {
+			line := strings.TrimSuffix(op.line, "\n")
+			switch op.kind {
+			case '-':
+				out.WriteString(paint(colorRed, "-"+line) + "\n")
+			case '+':
+				out.WriteString(paint(colorGreen, "+"+line) + "\n")
+			default:
+				out.WriteString(" " + line + "\n")
+			}
+			if !strings.HasSuffix(op.line, "\n") {
+				out.WriteString("\\ No newline at end of file\n")
+			}
+		}
+
+		start = to
+	}
+}
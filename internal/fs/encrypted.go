@@ -0,0 +1,31 @@
+package fs
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/rsvinicius/dotme/internal/secret"
+)
+
+// Decrypter returns the plaintext of an encrypted source file
+type Decrypter func(data []byte) ([]byte, error)
+
+// isEncrypted reports whether the source file at path is encrypted. A file
+// named just .enc is not, since stripping the suffix would leave no name.
+func isEncrypted(path string) bool {
+	name := filepath.Base(path)
+	return strings.HasSuffix(name, secret.Suffix) && len(name) > len(secret.Suffix)
+}
+
+// decryptFile decrypts the content of the encrypted source file src
+func (p *planner) decryptFile(src string, data []byte) ([]byte, error) {
+	if p.decrypt == nil {
+		return nil, fmt.Errorf("cannot decrypt %s: no decryption key is configured", src)
+	}
+	plaintext, err := p.decrypt(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: %w", src, err)
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,514 @@
+package fs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ArrayMerge selects how arrays present in both files are merged
+type ArrayMerge string
+
+const (
+	ArraysReplace ArrayMerge = "replace" // Use the incoming array
+	ArraysUnion   ArrayMerge = "union"   // Append incoming items missing from the existing array
+	ArraysKeep    ArrayMerge = "keep"    // Keep the existing array
+)
+
+// ArrayMerges lists the valid array merge modes
+var ArrayMerges = []ArrayMerge{ArraysReplace, ArraysUnion, ArraysKeep}
+
+// ParseArrayMerge parses an array merge mode, where empty means replace
+func ParseArrayMerge(name string) (ArrayMerge, error) {
+	if name == "" {
+		return ArraysReplace, nil
+	}
+	for _, mode := range ArrayMerges {
+		if string(mode) == name {
+			return mode, nil
+		}
+	}
+	return "", fmt.Errorf("invalid array merge mode %q, expected one of %v", name, ArrayMerges)
+}
+
+// MergeJSON deep-merges the incoming JSON or JSONC document into the existing
+// one. Incoming members are added to existing objects and replace existing
+// values otherwise, with arrays merged according to arrays. The comments, key
+// order and indentation of the existing file are kept; the existing content is
+// returned as is when the merge does not change it.
+func MergeJSON(existing, incoming []byte, arrays ArrayMerge) ([]byte, error) {
+	incomingDoc, err := parseJSONC(incoming)
+	if err != nil {
+		return nil, fmt.Errorf("invalid incoming JSON: %w", err)
+	}
+	existingDoc, err := parseJSONC(existing)
+	if err != nil {
+		return nil, fmt.Errorf("invalid existing JSON: %w", err)
+	}
+	if existingDoc.root == nil {
+		return incoming, nil
+	}
+	if incomingDoc.root == nil {
+		return existing, nil
+	}
+
+	merged := *existingDoc
+	merged.root = mergeJSONNodes(existingDoc.root, incomingDoc.root, arrays)
+	out := merged.format()
+	if bytes.Equal(out, existingDoc.format()) {
+		return existing, nil
+	}
+	return out, nil
+}
+
+// mergeJSONNodes returns incoming deep-merged into existing
+func mergeJSONNodes(existing, incoming *jsonNode, arrays ArrayMerge) *jsonNode {
+	switch {
+	case existing.kind == jsonObject && incoming.kind == jsonObject:
+		merged := *existing
+		merged.entries = append([]*jsonEntry(nil), existing.entries...)
+		index := map[string]int{}
+		for i, entry := range merged.entries {
+			index[entry.key] = i
+		}
+		for _, entry := range incoming.entries {
+			i, ok := index[entry.key]
+			if !ok {
+				index[entry.key] = len(merged.entries)
+				merged.entries = append(merged.entries, entry)
+				continue
+			}
+			mergedEntry := *merged.entries[i]
+			mergedEntry.value = mergeJSONNodes(mergedEntry.value, entry.value, arrays)
+			merged.entries[i] = &mergedEntry
+		}
+		return &merged
+	case existing.kind == jsonArray && incoming.kind == jsonArray && arrays == ArraysKeep:
+		return existing
+	case existing.kind == jsonArray && incoming.kind == jsonArray && arrays == ArraysUnion:
+		merged := *existing
+		merged.entries = append([]*jsonEntry(nil), existing.entries...)
+		seen := map[string]bool{}
+		for _, entry := range existing.entries {
+			seen[entry.value.canonical()] = true
+		}
+		for _, entry := range incoming.entries {
+			if key := entry.value.canonical(); !seen[key] {
+				seen[key] = true
+				merged.entries = append(merged.entries, entry)
+			}
+		}
+		return &merged
+	default:
+		return incoming
+	}
+}
+
+// jsonKind is the type of a JSON value
+type jsonKind int
+
+const (
+	jsonScalar jsonKind = iota
+	jsonObject
+	jsonArray
+)
+
+// jsonNode is a parsed JSON value that keeps its comments and the literal
+// text of scalars, so that a merged file can be written back faithfully
+type jsonNode struct {
+	kind      jsonKind
+	raw       string       // Literal text of a scalar
+	entries   []*jsonEntry // Members of an object or items of an array
+	trailing  []string     // Comments before the closing bracket
+	multiline bool         // Whether the brackets were on different lines
+}
+
+// jsonEntry is an object member or array item with its comments
+type jsonEntry struct {
+	key      string // Decoded key of an object member
+	rawKey   string // Literal text of the key
+	value    *jsonNode
+	comments []string // Comments on the lines before the entry
+	comment  string   // Comment after the entry on the same line
+}
+
+// jsonDocument is a parsed JSON file; root is nil when it holds no value
+type jsonDocument struct {
+	root     *jsonNode
+	leading  []string // Comments before the value
+	trailing []string // Comments after the value
+	indent   string
+	eol      string
+	final    bool // Whether the file ends with a line break
+}
+
+// canonical returns the value without comments or formatting, with object
+// keys sorted, so that equal values have equal representations
+func (n *jsonNode) canonical() string {
+	var compact strings.Builder
+	(&jsonWriter{}).compact(&compact, n)
+	var value any
+	if err := json.Unmarshal([]byte(compact.String()), &value); err != nil {
+		return compact.String()
+	}
+	canonical, err := json.Marshal(value)
+	if err != nil {
+		return compact.String()
+	}
+	return string(canonical)
+}
+
+// inline reports whether the node is written on a single line: it was written
+// that way and holds no comments nor multiline values
+func (n *jsonNode) inline() bool {
+	if n.kind == jsonScalar {
+		return true
+	}
+	if n.multiline || len(n.trailing) > 0 {
+		return false
+	}
+	for _, entry := range n.entries {
+		if len(entry.comments) > 0 || entry.comment != "" || !entry.value.inline() {
+			return false
+		}
+	}
+	return true
+}
+
+// format writes the document with its indentation and line breaks
+func (d *jsonDocument) format() []byte {
+	var b strings.Builder
+	w := &jsonWriter{indent: d.indent, eol: d.eol}
+	for _, comment := range d.leading {
+		b.WriteString(comment + d.eol)
+	}
+	w.write(&b, d.root, 0)
+	for _, comment := range d.trailing {
+		b.WriteString(d.eol + comment)
+	}
+	if d.final {
+		b.WriteString(d.eol)
+	}
+	return []byte(b.String())
+}
+
+// jsonWriter formats JSON nodes
+type jsonWriter struct {
+	indent string
+	eol    string
+}
+
+// write writes node, whose first line is indented depth times
+func (w *jsonWriter) write(b *strings.Builder, n *jsonNode, depth int) {
+	if n.kind == jsonScalar {
+		b.WriteString(n.raw)
+		return
+	}
+
+	open, close := "[", "]"
+	if n.kind == jsonObject {
+		open, close = "{", "}"
+	}
+	if len(n.entries) == 0 && len(n.trailing) == 0 {
+		b.WriteString(open + close)
+		return
+	}
+	if n.inline() {
+		b.WriteString(open)
+		for i, entry := range n.entries {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			if n.kind == jsonObject {
+				b.WriteString(entry.rawKey + ": ")
+			}
+			w.write(b, entry.value, depth)
+		}
+		b.WriteString(close)
+		return
+	}
+
+	inner := w.eol + strings.Repeat(w.indent, depth+1)
+	b.WriteString(open)
+	for i, entry := range n.entries {
+		for _, comment := range entry.comments {
+			b.WriteString(inner + comment)
+		}
+		b.WriteString(inner)
+		if n.kind == jsonObject {
+			b.WriteString(entry.rawKey + ": ")
+		}
+		w.write(b, entry.value, depth+1)
+		if i < len(n.entries)-1 {
+			b.WriteString(",")
+		}
+		if entry.comment != "" {
+			b.WriteString(" " + entry.comment)
+		}
+	}
+	for _, comment := range n.trailing {
+		b.WriteString(inner + comment)
+	}
+	b.WriteString(w.eol + strings.Repeat(w.indent, depth) + close)
+}
+
+// compact writes node as plain JSON without comments or whitespace
+func (w *jsonWriter) compact(b *strings.Builder, n *jsonNode) {
+	if n.kind == jsonScalar {
+		b.WriteString(n.raw)
+		return
+	}
+	open, close := "[", "]"
+	if n.kind == jsonObject {
+		open, close = "{", "}"
+	}
+	b.WriteString(open)
+	for i, entry := range n.entries {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		if n.kind == jsonObject {
+			b.WriteString(entry.rawKey + ":")
+		}
+		w.compact(b, entry.value)
+	}
+	b.WriteString(close)
+}
+
+// parseJSONC parses a JSON document that may contain comments and trailing commas
+func parseJSONC(data []byte) (*jsonDocument, error) {
+	doc := &jsonDocument{indent: detectIndent(data), eol: "\n"}
+	if bytes.Contains(data, []byte("\r\n")) {
+		doc.eol = "\r\n"
+	}
+	doc.final = bytes.HasSuffix(data, []byte("\n"))
+
+	p := &jsonParser{data: data}
+	var err error
+	if doc.leading, err = p.comments(); err != nil {
+		return nil, err
+	}
+	if p.pos == len(data) {
+		return doc, nil
+	}
+	if doc.root, err = p.value(); err != nil {
+		return nil, err
+	}
+	if doc.trailing, err = p.comments(); err != nil {
+		return nil, err
+	}
+	if p.pos != len(data) {
+		return nil, p.errorf("unexpected %q after the value", p.data[p.pos])
+	}
+	return doc, nil
+}
+
+// detectIndent returns the indentation of the first indented line, or two spaces
+func detectIndent(data []byte) string {
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed != line && strings.TrimSpace(trimmed) != "" {
+			return line[:len(line)-len(trimmed)]
+		}
+	}
+	return "  "
+}
+
+// jsonParser reads JSONC values from data
+type jsonParser struct {
+	data []byte
+	pos  int
+}
+
+// errorf returns a parse error at the current line
+func (p *jsonParser) errorf(format string, args ...any) error {
+	line := 1 + bytes.Count(p.data[:p.pos], []byte("\n"))
+	return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+// comments skips whitespace and returns the comments it contains
+func (p *jsonParser) comments() ([]string, error) {
+	var comments []string
+	for p.pos < len(p.data) {
+		switch p.data[p.pos] {
+		case ' ', '\t', '\r', '\n':
+			p.pos++
+		case '/':
+			comment, err := p.comment()
+			if err != nil {
+				return nil, err
+			}
+			comments = append(comments, comment)
+		default:
+			return comments, nil
+		}
+	}
+	return comments, nil
+}
+
+// lineComment returns the comment following the current position on the same line, if any
+func (p *jsonParser) lineComment() (string, error) {
+	i := p.pos
+	for i < len(p.data) && (p.data[i] == ' ' || p.data[i] == '\t') {
+		i++
+	}
+	if i == len(p.data) || p.data[i] != '/' {
+		return "", nil
+	}
+	p.pos = i
+	return p.comment()
+}
+
+// comment reads the // or /* */ comment at the current position
+func (p *jsonParser) comment() (string, error) {
+	rest := p.data[p.pos:]
+	switch {
+	case bytes.HasPrefix(rest, []byte("//")):
+		end := bytes.IndexByte(rest, '\n')
+		if end < 0 {
+			end = len(rest)
+		}
+		p.pos += end
+		return strings.TrimRight(string(rest[:end]), " \t\r"), nil
+	case bytes.HasPrefix(rest, []byte("/*")):
+		end := bytes.Index(rest[2:], []byte("*/"))
+		if end < 0 {
+			return "", p.errorf("unterminated comment")
+		}
+		p.pos += end + 4
+		return string(rest[:end+4]), nil
+	default:
+		return "", p.errorf("unexpected '/'")
+	}
+}
+
+// value reads the value at the current position
+func (p *jsonParser) value() (*jsonNode, error) {
+	if p.pos == len(p.data) {
+		return nil, p.errorf("unexpected end of file")
+	}
+	switch c := p.data[p.pos]; c {
+	case '{':
+		return p.container(jsonObject, '}')
+	case '[':
+		return p.container(jsonArray, ']')
+	case '"':
+		raw, err := p.string()
+		if err != nil {
+			return nil, err
+		}
+		return &jsonNode{kind: jsonScalar, raw: raw}, nil
+	default:
+		start := p.pos
+		for p.pos < len(p.data) && strings.IndexByte("+-.0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ", p.data[p.pos]) >= 0 {
+			p.pos++
+		}
+		raw := string(p.data[start:p.pos])
+		if raw == "" || !json.Valid([]byte(raw)) {
+			p.pos = start
+			return nil, p.errorf("invalid value starting with %q", c)
+		}
+		return &jsonNode{kind: jsonScalar, raw: raw}, nil
+	}
+}
+
+// string reads the string literal at the current position
+func (p *jsonParser) string() (string, error) {
+	start := p.pos
+	for p.pos++; p.pos < len(p.data); p.pos++ {
+		switch p.data[p.pos] {
+		case '\\':
+			p.pos++
+		case '"':
+			p.pos++
+			raw := string(p.data[start:p.pos])
+			if !json.Valid([]byte(raw)) {
+				p.pos = start
+				return "", p.errorf("invalid string %s", raw)
+			}
+			return raw, nil
+		case '\n':
+			p.pos = start
+			return "", p.errorf("unterminated string")
+		}
+	}
+	p.pos = start
+	return "", p.errorf("unterminated string")
+}
+
+// container reads the object or array at the current position, allowing a
+// trailing comma before the closing bracket
+func (p *jsonParser) container(kind jsonKind, close byte) (*jsonNode, error) {
+	node := &jsonNode{kind: kind}
+	start := p.pos
+	p.pos++
+
+	var pending []string
+	needComma := false
+	for {
+		comments, err := p.comments()
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, comments...)
+		if p.pos == len(p.data) {
+			return nil, p.errorf("unexpected end of file, expected %q", close)
+		}
+
+		c := p.data[p.pos]
+		if c == close {
+			p.pos++
+			node.trailing = pending
+			node.multiline = bytes.IndexByte(p.data[start:p.pos], '\n') >= 0
+			return node, nil
+		}
+		if needComma {
+			if c != ',' {
+				return nil, p.errorf("expected ',' or %q, found %q", close, c)
+			}
+			p.pos++
+			needComma = false
+			comment, err := p.lineComment()
+			if err != nil {
+				return nil, err
+			}
+			if last := node.entries[len(node.entries)-1]; comment != "" {
+				last.comment = strings.TrimSpace(last.comment + " " + comment)
+			}
+			continue
+		}
+
+		entry := &jsonEntry{comments: pending}
+		pending = nil
+		if kind == jsonObject {
+			if c != '"' {
+				return nil, p.errorf("expected a string key, found %q", c)
+			}
+			if entry.rawKey, err = p.string(); err != nil {
+				return nil, err
+			}
+			if err := json.Unmarshal([]byte(entry.rawKey), &entry.key); err != nil {
+				return nil, p.errorf("invalid key %s", entry.rawKey)
+			}
+			if _, err := p.comments(); err != nil {
+				return nil, err
+			}
+			if p.pos == len(p.data) || p.data[p.pos] != ':' {
+				return nil, p.errorf("expected ':' after key %s", entry.rawKey)
+			}
+			p.pos++
+			if _, err := p.comments(); err != nil {
+				return nil, err
+			}
+		}
+		if entry.value, err = p.value(); err != nil {
+			return nil, err
+		}
+		if entry.comment, err = p.lineComment(); err != nil {
+			return nil, err
+		}
+		node.entries = append(node.entries, entry)
+		needComma = true
+	}
+}
@@ -0,0 +1,206 @@
+package fs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// lfsPointerMaxSize is the size above which files are never LFS pointers
+const lfsPointerMaxSize = 1024
+
+// lfsPointerVersion is the first line of every Git LFS pointer file
+const lfsPointerVersion = "version https://git-lfs.github.com/spec/v1"
+
+var lfsOidPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// LFSPointer identifies a Git LFS object referenced by a pointer file
+type LFSPointer struct {
+	Oid  string // SHA-256 of the object content
+	Size int64  // Size of the object in bytes
+}
+
+// LFSFetcher writes the content of a Git LFS object to the file at dst
+type LFSFetcher func(ctx context.Context, oid string, size int64, dst string) error
+
+// ParseLFSPointer parses the content of a Git LFS pointer file. The second
+// return value is false when data is not a pointer.
+func ParseLFSPointer(data []byte) (*LFSPointer, bool) {
+	if len(data) > lfsPointerMaxSize || !bytes.HasPrefix(data, []byte(lfsPointerVersion+"\n")) {
+		return nil, false
+	}
+
+	pointer := &LFSPointer{Size: -1}
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "oid":
+			pointer.Oid = strings.TrimPrefix(value, "sha256:")
+		case "size":
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, false
+			}
+			pointer.Size = size
+		}
+	}
+
+	if !lfsOidPattern.MatchString(pointer.Oid) || pointer.Size < 0 {
+		return nil, false
+	}
+	return pointer, true
+}
+
+// lfsObjects maps the source paths of LFS pointer files to temporary files
+// holding the fetched objects
+type lfsObjects struct {
+	dir     string
+	objects map[string]string
+}
+
+// content returns the file whose content should be copied for src
+func (o *lfsObjects) content(src string) string {
+	if o != nil {
+		if object, ok := o.objects[src]; ok {
+			return object
+		}
+	}
+	return src
+}
+
+// remove deletes the temporary files holding the fetched objects
+func (o *lfsObjects) remove() {
+	if o != nil && o.dir != "" {
+		os.RemoveAll(o.dir)
+	}
+}
+
+// fetchLFSObjects finds the LFS pointer files among the given source paths
+// and fetches their objects before anything is copied, so that a missing
+// object never leaves a half-applied destination. Symbolic links into root
+// are followed when follow is set, as the planner reads through them. Without
+// a fetcher the pointer files are refused.
+func fetchLFSObjects(ctx context.Context, srcDir, root string, follow bool, paths []string, fetch LFSFetcher) (*lfsObjects, error) {
+	pointers := map[string]*LFSPointer{}
+	for _, path := range paths {
+		if err := scanLFSPointers(ctx, path, root, follow, pointers); err != nil {
+			return nil, fmt.Errorf("failed to scan %s for Git LFS pointers: %w", path, err)
+		}
+	}
+	if len(pointers) == 0 {
+		return nil, nil
+	}
+
+	files := make([]string, 0, len(pointers))
+	for file := range pointers {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	relative := func(file string) string {
+		if rel, err := filepath.Rel(srcDir, file); err == nil {
+			return filepath.ToSlash(rel)
+		}
+		return file
+	}
+
+	if fetch == nil {
+		var message strings.Builder
+		fmt.Fprintf(&message, "refusing to copy %d Git LFS pointer files whose content is not available:", len(files))
+		for _, file := range files {
+			fmt.Fprintf(&message, "\n   - %s", relative(file))
+		}
+		return nil, fmt.Errorf("%s", message.String())
+	}
+
+	tempDir, err := os.MkdirTemp("", "dotme-lfs-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	objects := &lfsObjects{dir: tempDir, objects: map[string]string{}}
+
+	var failures []string
+	for i, file := range files {
+		pointer := pointers[file]
+		dst := filepath.Join(tempDir, strconv.Itoa(i))
+		if err := fetch(ctx, pointer.Oid, pointer.Size, dst); err != nil {
+			if ctx.Err() != nil {
+				objects.remove()
+				return nil, ctx.Err()
+			}
+			failures = append(failures, fmt.Sprintf("%s: %s", relative(file), err))
+			continue
+		}
+		objects.objects[file] = dst
+		fmt.Printf("📥 Fetched Git LFS object: %s\n", relative(file))
+	}
+
+	if len(failures) > 0 {
+		objects.remove()
+		return nil, fmt.Errorf("failed to fetch %d Git LFS objects:\n   - %s", len(failures), strings.Join(failures, "\n   - "))
+	}
+	return objects, nil
+}
+
+// scanLFSPointers adds the LFS pointer files at path to pointers, keyed by
+// the path the planner reads them from. Links the planner refuses to follow
+// are left out for it to report.
+func scanLFSPointers(ctx context.Context, path, root string, follow bool, pointers map[string]*LFSPointer) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		if !follow {
+			return nil
+		}
+		resolved, err := filepath.EvalSymlinks(path)
+		if err != nil || !within(root, resolved) {
+			return nil
+		}
+		if info, err = os.Stat(resolved); err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			dir, err := filepath.EvalSymlinks(filepath.Dir(path))
+			if err != nil || within(resolved, dir) {
+				return nil
+			}
+		}
+	}
+
+	switch {
+	case info.IsDir():
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.Name() == ".git" {
+				continue
+			}
+			if err := scanLFSPointers(ctx, filepath.Join(path, entry.Name()), root, follow, pointers); err != nil {
+				return err
+			}
+		}
+	case info.Mode().IsRegular() && info.Size() <= lfsPointerMaxSize:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if pointer, ok := ParseLFSPointer(data); ok {
+			pointers[path] = pointer
+		}
+	}
+	return nil
+}
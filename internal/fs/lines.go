@@ -0,0 +1,73 @@
+package fs
+
+import (
+	"bytes"
+	"strings"
+)
+
+// isIgnoreFile reports whether name is an ignore file such as .gitignore or
+// .dockerignore, which are merged line by line
+func isIgnoreFile(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, "ignore") && len(name) >= len(".ignore")
+}
+
+// MergeLines appends the incoming lines missing from the existing content,
+// which is kept as is. Blank lines are never added and a comment is only
+// added with the missing lines it precedes, so re-applying adds nothing.
+func MergeLines(existing, incoming []byte) []byte {
+	eol := "\n"
+	if bytes.Contains(existing, []byte("\r\n")) {
+		eol = "\r\n"
+	}
+
+	present := map[string]bool{}
+	existingLines := trimmedLines(existing)
+	for _, line := range existingLines {
+		present[line] = true
+	}
+
+	var added, comments []string
+	for _, line := range trimmedLines(incoming) {
+		switch {
+		case line == "":
+			comments = nil
+		case strings.HasPrefix(strings.TrimSpace(line), "#"):
+			comments = append(comments, line)
+		case present[line]:
+			comments = nil
+		default:
+			for _, comment := range comments {
+				if !present[comment] {
+					present[comment] = true
+					added = append(added, comment)
+				}
+			}
+			comments = nil
+			present[line] = true
+			added = append(added, line)
+		}
+	}
+	if len(added) == 0 {
+		return existing
+	}
+
+	var b strings.Builder
+	b.Write(existing)
+	if len(existing) > 0 && !bytes.HasSuffix(existing, []byte("\n")) {
+		b.WriteString(eol)
+	}
+	if n := len(existingLines); n > 0 && existingLines[n-1] != "" {
+		b.WriteString(eol)
+	}
+	b.WriteString(strings.Join(added, eol) + eol)
+	return []byte(b.String())
+}
+
+// trimmedLines splits data into lines without terminators or trailing whitespace
+func trimmedLines(data []byte) []string {
+	lines := splitLines(string(data))
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r\n")
+	}
+	return lines
+}
@@ -0,0 +1,80 @@
+package fs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// LinkMode selects whether dotfiles are copied or linked, and at which granularity
+type LinkMode string
+
+const (
+	LinkNone  LinkMode = ""     // Copy files
+	LinkFiles LinkMode = "file" // Link every file, creating real directories in the destination
+	LinkDirs  LinkMode = "dir"  // Link every root entry, including whole directories
+)
+
+// ParseLinkMode parses the granularity given to --link
+func ParseLinkMode(name string) (LinkMode, error) {
+	switch LinkMode(name) {
+	case LinkNone, LinkFiles, LinkDirs:
+		return LinkMode(name), nil
+	default:
+		return "", fmt.Errorf("invalid link mode %q, expected %s or %s", name, LinkFiles, LinkDirs)
+	}
+}
+
+// planLinkTo adds an action replacing dest with a symbolic link to src
+func (p *planner) planLinkTo(src string, info os.FileInfo, dest string) error {
+	target, err := filepath.Abs(src)
+	if err != nil {
+		return fmt.Errorf("failed to resolve path %s: %w", src, err)
+	}
+	return p.planLink(src, target, info, dest)
+}
+
+// planLink adds an action replacing dest with a symbolic link to target.
+// Existing links are replaced, while existing files are conflicts resolved
+// like when copying. Existing directories are never replaced.
+func (p *planner) planLink(src, target string, info os.FileInfo, dest string) error {
+	action := &FileAction{
+		Src:     src,
+		Dest:    dest,
+		Link:    target,
+		Mode:    info.Mode().Perm(),
+		content: src,
+	}
+	if !info.IsDir() {
+		action.Size = info.Size()
+	}
+	if rel, err := filepath.Rel(p.destDir, dest); err == nil {
+		action.Path = filepath.ToSlash(rel)
+	}
+
+	destInfo, err := os.Lstat(dest)
+	switch {
+	case os.IsNotExist(err):
+		action.Change = ChangeCreate
+	case err != nil:
+		return fmt.Errorf("failed to get destination file info %s: %w", dest, err)
+	case destInfo.Mode()&os.ModeSymlink != 0:
+		if action.OldLink, err = os.Readlink(dest); err != nil {
+			return fmt.Errorf("failed to read link %s: %w", dest, err)
+		}
+		action.Change = ChangeOverwrite
+		if action.OldLink == target {
+			action.Change = ChangeUnchanged
+		}
+	case destInfo.IsDir() && p.link == LinkDirs:
+		return fmt.Errorf("cannot link %s: %s is an existing directory, remove it or use --link=file", src, dest)
+	case destInfo.IsDir():
+		return fmt.Errorf("cannot replace directory %s with a symbolic link to %s", dest, target)
+	default:
+		action.OldSize = destInfo.Size()
+		action.OldMode = destInfo.Mode().Perm()
+		action.Change = ChangeOverwrite
+	}
+
+	return p.add(action)
+}
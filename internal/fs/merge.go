@@ -0,0 +1,139 @@
+package fs
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ConflictRule applies a conflict strategy to the files matching a pattern
+type ConflictRule struct {
+	Pattern  string // Glob matched against the slash-separated destination path, or the file name when it has no slash
+	Strategy ConflictStrategy
+}
+
+// ParseConflictRule parses a rule written as <strategy>:<pattern>, such as
+// merge:.vscode/*.json. Merging and managed blocks are only accepted for
+// selected files.
+func ParseConflictRule(value string) (ConflictRule, error) {
+	name, pattern, ok := strings.Cut(value, ":")
+	if !ok || pattern == "" {
+		return ConflictRule{}, fmt.Errorf("invalid conflict rule %q, expected <strategy>:<pattern>", value)
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return ConflictRule{}, fmt.Errorf("invalid pattern in conflict rule %q: %w", value, err)
+	}
+	if _, ok := ruleExamples[ConflictStrategy(name)]; ok {
+		return ConflictRule{Pattern: pattern, Strategy: ConflictStrategy(name)}, nil
+	}
+	strategy, err := ParseConflictStrategy(name)
+	if err != nil {
+		return ConflictRule{}, err
+	}
+	return ConflictRule{Pattern: pattern, Strategy: strategy}, nil
+}
+
+// matches reports whether the rule applies to the destination path rel
+func (r ConflictRule) matches(rel string) bool {
+	if !strings.Contains(r.Pattern, "/") {
+		rel = path.Base(rel)
+	}
+	matched, _ := path.Match(r.Pattern, rel)
+	return matched
+}
+
+// strategyFor returns the conflict strategy for the destination path rel: that
+// of the last matching rule, or fallback
+func strategyFor(rel string, rules []ConflictRule, fallback ConflictStrategy) ConflictStrategy {
+	strategy := fallback
+	for _, rule := range rules {
+		if rule.matches(rel) {
+			strategy = rule.Strategy
+		}
+	}
+	return strategy
+}
+
+// mergeFormat returns the function merging the file at path, which is
+// chosen by its name
+func mergeFormat(name string, arrays ArrayMerge) (func(existing, incoming []byte) ([]byte, error), error) {
+	switch {
+	case isIgnoreFile(path.Base(name)):
+		return func(existing, incoming []byte) ([]byte, error) {
+			return MergeLines(existing, incoming), nil
+		}, nil
+	case strings.EqualFold(filepath.Ext(name), ".json"), strings.EqualFold(filepath.Ext(name), ".jsonc"):
+		return func(existing, incoming []byte) ([]byte, error) {
+			return MergeJSON(existing, incoming, arrays)
+		}, nil
+	default:
+		return nil, fmt.Errorf("cannot merge %s: only JSON and ignore files can be merged", name)
+	}
+}
+
+// merge replaces the incoming content of an action with its merge into the
+// existing file when a merge or block rule selects it. Merging only applies
+// to existing files, while managed blocks are also written into new files.
+// The existing mode is kept unless the incoming one is stricter, and an
+// existing file is only left unchanged when the merged content matches it.
+func (p *planner) merge(action *FileAction) error {
+	strategy := strategyFor(action.Path, p.rules, "")
+	switch {
+	case strategy != ConflictMerge && strategy != ConflictBlock:
+		return nil
+	case strategy == ConflictMerge && action.Change == ChangeCreate:
+		return nil
+	}
+
+	failure := "cannot merge " + action.Path
+	if strategy == ConflictBlock {
+		failure = "cannot write the managed block of " + action.Path
+	}
+	if action.Link != "" || action.OldLink != "" {
+		return fmt.Errorf("%s: only regular files can be merged", failure)
+	}
+
+	mergeFile := func(existing, incoming []byte) ([]byte, error) {
+		if isBinary(incoming) {
+			return nil, fmt.Errorf("the file is binary")
+		}
+		return WriteBlock(existing, incoming, p.blockName)
+	}
+	if strategy == ConflictMerge {
+		var err error
+		if mergeFile, err = mergeFormat(action.Path, p.arrays); err != nil {
+			return err
+		}
+	}
+
+	var existing []byte
+	if action.Change != ChangeCreate {
+		var err error
+		if existing, err = os.ReadFile(action.Dest); err != nil {
+			return fmt.Errorf("failed to read %s: %w", action.Dest, err)
+		}
+	}
+	incoming, err := action.read()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", action.Src, err)
+	}
+	merged, err := mergeFile(existing, incoming)
+	if err != nil {
+		return fmt.Errorf("%s: %w", failure, err)
+	}
+
+	action.data = merged
+	action.Size = int64(len(merged))
+	if action.Change == ChangeCreate {
+		return nil
+	}
+	action.Mode = action.OldMode & action.Mode
+	action.Change = ChangeOverwrite
+	if bytes.Equal(merged, existing) && action.Mode == action.OldMode {
+		action.Change = ChangeUnchanged
+	}
+	return nil
+}
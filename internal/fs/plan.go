@@ -0,0 +1,459 @@
+package fs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rsvinicius/dotme/internal/secret"
+)
+
+// Change describes what applying a file does to the destination
+type Change int
+
+const (
+	ChangeCreate    Change = iota // The file does not exist in the destination
+	ChangeOverwrite               // The file exists with different content or mode
+	ChangeUnchanged               // The file exists with the same content and mode
+)
+
+// String returns the name of the change shown in reports
+func (c Change) String() string {
+	switch c {
+	case ChangeCreate:
+		return "create"
+	case ChangeOverwrite:
+		return "overwrite"
+	default:
+		return "unchanged"
+	}
+}
+
+// FileAction describes a file that applying the dotfiles writes into the destination
+type FileAction struct {
+	Path    string      // Path relative to the destination, with forward slashes
+	Src     string      // Source file
+	Dest    string      // Destination file
+	Change  Change      // Effect on the destination
+	Size    int64       // Size of the incoming content
+	Mode    os.FileMode // Permissions of the incoming file
+	OldSize int64       // Size of the existing file, if any
+	OldMode os.FileMode // Permissions of the existing file, if any
+	Link    string      // Target of the symbolic link written instead of the content, when linking
+	OldLink string      // Target of the existing symbolic link replaced by a link, if any
+	Outcome Outcome     // Effect of applying the action, set once applied
+	Backup  string      // Backup of the existing file made by the backup strategy
+	Secret  bool        // The incoming content was decrypted, so diffs only show its hash
+
+	content string // File holding the incoming content, which differs from Src for Git LFS objects
+	data    []byte // Incoming content generated while planning, such as a rendered template; nil copies content
+}
+
+// open returns a reader of the incoming content of the action
+func (a *FileAction) open() (io.ReadCloser, error) {
+	if a.data != nil {
+		return io.NopCloser(bytes.NewReader(a.data)), nil
+	}
+	return os.Open(a.content)
+}
+
+// read returns the incoming content of the action
+func (a *FileAction) read() ([]byte, error) {
+	if a.data != nil {
+		return a.data, nil
+	}
+	return os.ReadFile(a.content)
+}
+
+// Plan is the set of file actions that applying dotfiles performs
+type Plan struct {
+	Actions  []*FileAction // Files written into the destination
+	Selected []string      // Root entries selected by the filter, directories with a trailing slash
+	Ignored  []string      // Root entries excluded by the filter
+	Skipped  []string      // Symbolic links left out by SymlinksSkip
+
+	lfs *lfsObjects
+}
+
+// Close releases the Git LFS objects fetched for the plan
+func (p *Plan) Close() {
+	p.lfs.remove()
+}
+
+// planner builds the list of file actions for the selected source entries
+type planner struct {
+	ctx       context.Context
+	destDir   string
+	lfs       *lfsObjects
+	link      LinkMode
+	symlinks  SymlinkPolicy
+	root      string         // Resolved directory symbolic links may point into
+	data      map[string]any // Data templates are rendered with
+	decrypt   Decrypter
+	rules     []ConflictRule
+	arrays    ArrayMerge
+	blockName string
+	actions   []*FileAction
+	skipped   []string
+	dests     map[string]string // Source of each planned destination, to detect clashes
+}
+
+// add appends an action, rejecting a second action for the same destination
+// such as both .gitconfig and .gitconfig.tmpl
+func (p *planner) add(action *FileAction) error {
+	if p.dests == nil {
+		p.dests = map[string]string{}
+	}
+	if other, ok := p.dests[action.Dest]; ok {
+		return fmt.Errorf("both %s and %s would be written to %s", other, action.Src, action.Dest)
+	}
+	p.dests[action.Dest] = action.Src
+	if err := p.merge(action); err != nil {
+		return err
+	}
+	p.actions = append(p.actions, action)
+	return nil
+}
+
+// planRoot adds the actions for a root entry of the source, which is linked
+// as a whole when linking directories
+func (p *planner) planRoot(src, dest string) error {
+	if p.link != LinkDirs {
+		return p.plan(src, dest)
+	}
+	if handled, err := p.planSymlink(src, dest); handled || err != nil {
+		return err
+	}
+
+	info, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("failed to get source file info %s: %w", src, err)
+	}
+	if !info.IsDir() && isGenerated(src) {
+		return p.plan(src, dest)
+	}
+	return p.planLinkTo(src, info, dest)
+}
+
+// plan adds the actions for a source entry, descending into directories.
+// Nested git metadata, such as the .git file of a submodule, is skipped.
+func (p *planner) plan(src, dest string) error {
+	if err := p.ctx.Err(); err != nil {
+		return err
+	}
+	if handled, err := p.planSymlink(src, dest); handled || err != nil {
+		return err
+	}
+
+	info, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("failed to get source file info %s: %w", src, err)
+	}
+
+	if info.IsDir() {
+		if destInfo, err := os.Stat(dest); err == nil && !destInfo.IsDir() {
+			return fmt.Errorf("cannot copy directory %s: %s exists and is not a directory", src, dest)
+		}
+		if p.link == LinkFiles {
+			// Links created inside a linked directory would end up in the source
+			if destInfo, err := os.Lstat(dest); err == nil && destInfo.Mode()&os.ModeSymlink != 0 {
+				return fmt.Errorf("cannot link files into %s: it is a symbolic link, remove it or use --link=dir", dest)
+			}
+		}
+
+		entries, err := os.ReadDir(src)
+		if err != nil {
+			return fmt.Errorf("failed to read directory %s: %w", src, err)
+		}
+		for _, entry := range entries {
+			if entry.Name() == ".git" {
+				continue
+			}
+			if err := p.plan(filepath.Join(src, entry.Name()), filepath.Join(dest, entry.Name())); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Templates and encrypted files are generated and copied even when linking
+	generated := isGenerated(src)
+	if p.link == LinkFiles && !generated {
+		return p.planLinkTo(src, info, dest)
+	}
+	if generated {
+		dest = generatedName(dest)
+	}
+
+	action := &FileAction{
+		Src:     src,
+		Dest:    dest,
+		Mode:    info.Mode().Perm(),
+		content: p.lfs.content(src),
+	}
+	if rel, err := filepath.Rel(p.destDir, dest); err == nil {
+		action.Path = filepath.ToSlash(rel)
+	}
+
+	if generated {
+		if err := p.generate(action); err != nil {
+			return err
+		}
+		action.Size = int64(len(action.data))
+	} else {
+		contentInfo, err := os.Stat(action.content)
+		if err != nil {
+			return fmt.Errorf("failed to get source file info %s: %w", src, err)
+		}
+		action.Size = contentInfo.Size()
+	}
+
+	destInfo, err := os.Stat(dest)
+	switch {
+	case os.IsNotExist(err):
+		action.Change = ChangeCreate
+	case err != nil:
+		return fmt.Errorf("failed to get destination file info %s: %w", dest, err)
+	case destInfo.IsDir():
+		return fmt.Errorf("cannot copy file %s: %s is a directory", src, dest)
+	default:
+		action.OldSize = destInfo.Size()
+		action.OldMode = destInfo.Mode().Perm()
+		same, err := sameIncoming(action)
+		if err != nil {
+			return err
+		}
+		action.Change = ChangeOverwrite
+		if same && action.Mode == action.OldMode {
+			action.Change = ChangeUnchanged
+		}
+	}
+
+	return p.add(action)
+}
+
+// isGenerated reports whether the source file at path is a template or
+// encrypted, so that its content is produced at plan time
+func isGenerated(path string) bool {
+	return isTemplate(path) || isEncrypted(path)
+}
+
+// generatedName strips the encrypted and template suffixes from path, in that order
+func generatedName(path string) string {
+	if isEncrypted(path) {
+		path = strings.TrimSuffix(path, secret.Suffix)
+	}
+	if isTemplate(path) {
+		path = strings.TrimSuffix(path, templateSuffix)
+	}
+	return path
+}
+
+// generate produces the content of a generated file in memory. Encrypted
+// files are decrypted first, so a .tmpl.enc file is an encrypted template.
+func (p *planner) generate(action *FileAction) error {
+	name := filepath.Base(action.Src)
+	data, err := os.ReadFile(action.content)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", action.Src, err)
+	}
+
+	if isEncrypted(name) {
+		if data, err = p.decryptFile(action.Src, data); err != nil {
+			return err
+		}
+		// Decrypted secrets are only ever readable by their owner
+		action.Mode = 0600
+		action.Secret = true
+		name = strings.TrimSuffix(name, secret.Suffix)
+	}
+	if isTemplate(name) {
+		if data, err = renderTemplate(data, action.Path+templateSuffix, p.data); err != nil {
+			return err
+		}
+	}
+
+	action.data = data
+	return nil
+}
+
+// sameIncoming reports whether the destination of an action already holds its incoming content
+func sameIncoming(action *FileAction) (bool, error) {
+	if action.data == nil {
+		return sameContent(action.content, action.Dest)
+	}
+	existing, err := os.ReadFile(action.Dest)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(existing, action.data), nil
+}
+
+// sameContent reports whether two files have identical content
+func sameContent(a, b string) (bool, error) {
+	aInfo, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	bInfo, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+	if aInfo.Size() != bInfo.Size() {
+		return false, nil
+	}
+
+	aFile, err := os.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer aFile.Close()
+	bFile, err := os.Open(b)
+	if err != nil {
+		return false, err
+	}
+	defer bFile.Close()
+
+	aBuf := make([]byte, 32*1024)
+	bBuf := make([]byte, 32*1024)
+	for {
+		aN, aErr := io.ReadFull(aFile, aBuf)
+		bN, bErr := io.ReadFull(bFile, bBuf)
+		if !bytes.Equal(aBuf[:aN], bBuf[:bN]) {
+			return false, nil
+		}
+		if aErr == io.EOF || aErr == io.ErrUnexpectedEOF {
+			return bErr == io.EOF || bErr == io.ErrUnexpectedEOF, nil
+		}
+		if aErr != nil {
+			return false, aErr
+		}
+		if bErr != nil {
+			return false, bErr
+		}
+	}
+}
+
+// printDryRun reports the actions that applying the dotfiles would perform,
+// naming the conflict strategy applied to existing files
+func printDryRun(actions []*FileAction, options *CopyOptions) {
+	conflictLabels := map[ConflictStrategy]string{
+		ConflictSkip:   "⏭️  skip     ",
+		ConflictBackup: "💾 backup   ",
+		ConflictPrompt: "❓ prompt   ",
+		ConflictFail:   "⛔ conflict ",
+		ConflictMerge:  "🔀 merge    ",
+		ConflictBlock:  "🧱 block    ",
+	}
+
+	var created, overwritten, unchanged, conflicts int
+	fmt.Printf("\n🔍 Dry run, the destination is not modified:\n")
+	for _, action := range actions {
+		switch action.Change {
+		case ChangeCreate:
+			created++
+			fmt.Printf("   ➕ create     %s (%s)\n", action.Path, describeNew(action))
+		case ChangeOverwrite:
+			overwritten++
+			strategy := strategyFor(action.Path, options.ConflictRules, options.OnConflict)
+			if strategy == ConflictFail {
+				conflicts++
+			}
+			conflictLabel, ok := conflictLabels[strategy]
+			if !ok {
+				conflictLabel = "✏️  overwrite"
+			}
+			fmt.Printf("   %s  %s (%s)\n", conflictLabel, action.Path, describeChange(action))
+		case ChangeUnchanged:
+			unchanged++
+			fmt.Printf("   ✔️  unchanged  %s (%s)\n", action.Path, describeNew(action))
+		}
+	}
+	fmt.Printf("\n📊 %d to create, %d to overwrite, %d unchanged\n", created, overwritten, unchanged)
+	if conflicts > 0 {
+		fmt.Printf("⛔ Applying would fail: %d files conflict with existing files\n", conflicts)
+	}
+}
+
+// describeNew describes the incoming file of an action
+func describeNew(action *FileAction) string {
+	if action.Link != "" {
+		return "link to " + action.Link
+	}
+	description := fmt.Sprintf("%s, %s", FormatSize(action.Size), action.Mode)
+	if name := filepath.Base(action.Src); name != filepath.Base(action.Dest) {
+		description += ", from " + name
+	}
+	return description
+}
+
+// describeChange describes how an action changes an existing file
+func describeChange(action *FileAction) string {
+	switch {
+	case action.OldLink != "":
+		return fmt.Sprintf("link to %s → %s", action.OldLink, describeNew(action))
+	case action.Link != "":
+		return fmt.Sprintf("%s file → link to %s", FormatSize(action.OldSize), action.Link)
+	default:
+		description := fmt.Sprintf("%s → %s, %s → %s",
+			FormatSize(action.OldSize), FormatSize(action.Size), action.OldMode, action.Mode)
+		if name := filepath.Base(action.Src); name != filepath.Base(action.Dest) {
+			description += ", from " + name
+		}
+		return description
+	}
+}
+
+// printOutcomes reports the effect of applying each file, listing the files
+// that were skipped or backed up
+func printOutcomes(actions []*FileAction) {
+	counts := map[Outcome]int{}
+	var skipped, backedUp []*FileAction
+	for _, action := range actions {
+		counts[action.Outcome]++
+		switch action.Outcome {
+		case OutcomeSkipped:
+			skipped = append(skipped, action)
+		case OutcomeBackedUp:
+			backedUp = append(backedUp, action)
+		}
+	}
+
+	fmt.Printf("\n📊 Files: %d created, %d overwritten, %d unchanged, %d skipped, %d backed up",
+		counts[OutcomeCreated], counts[OutcomeOverwritten], counts[OutcomeUnchanged],
+		counts[OutcomeSkipped], counts[OutcomeBackedUp])
+	if counts[OutcomeMerged] > 0 {
+		fmt.Printf(", %d merged", counts[OutcomeMerged])
+	}
+	fmt.Println()
+	if len(skipped) > 0 {
+		fmt.Printf("⏭️  Kept %d existing files:\n", len(skipped))
+		for _, action := range skipped {
+			fmt.Printf("   - %s\n", action.Path)
+		}
+	}
+	if len(backedUp) > 0 {
+		fmt.Printf("💾 Backed up %d existing files:\n", len(backedUp))
+		for _, action := range backedUp {
+			fmt.Printf("   - %s → %s\n", action.Path, action.Backup)
+		}
+	}
+}
+
+// FormatSize returns a human-readable representation of a size in bytes
+func FormatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,73 @@
+package fs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// conflictPrompt asks how to resolve each conflicting file, remembering a
+// choice that applies to all remaining files
+type conflictPrompt struct {
+	in          *bufio.Reader
+	out         io.Writer
+	color       bool
+	showSecrets bool
+	all         ConflictStrategy
+}
+
+// NewConflictPrompt returns a resolver that asks on out and reads answers
+// from in whether to overwrite, keep or back up each conflicting file. The
+// diff of a file can be viewed before deciding, an uppercase answer applies
+// to all remaining files and aborting stops the copy. Decrypted content is
+// only shown in diffs when showSecrets is set.
+func NewConflictPrompt(in io.Reader, out io.Writer, color, showSecrets bool) ConflictResolver {
+	p := &conflictPrompt{in: bufio.NewReader(in), out: out, color: color, showSecrets: showSecrets}
+	return p.resolve
+}
+
+// resolve asks for the strategy of a single conflicting file
+func (p *conflictPrompt) resolve(action *FileAction) (ConflictStrategy, error) {
+	if p.all != "" {
+		return p.all, nil
+	}
+
+	fmt.Fprintf(p.out, "\n⚠️  %s already exists and differs (%s → %s, %s → %s)\n", action.Path,
+		FormatSize(action.OldSize), FormatSize(action.Size), action.OldMode, action.Mode)
+	for {
+		fmt.Fprintf(p.out, "   [o] overwrite  [k] keep  [d] view diff  [b] back up  [q] abort\n")
+		fmt.Fprintf(p.out, "   Use O, K or B to apply the choice to all remaining files. Choice [k]: ")
+
+		answer, err := p.in.ReadString('\n')
+		if err != nil && answer == "" {
+			return "", fmt.Errorf("failed to read answer for %s: %w", action.Path, err)
+		}
+
+		answer = strings.TrimSpace(answer)
+		var choice ConflictStrategy
+		switch strings.ToLower(answer) {
+		case "o", "overwrite":
+			choice = ConflictOverwrite
+		case "", "k", "keep":
+			choice = ConflictSkip
+		case "b", "backup":
+			choice = ConflictBackup
+		case "q", "abort":
+			return ConflictFail, nil
+		case "d", "diff":
+			if err := WriteDiff(p.out, action, p.color, p.showSecrets); err != nil {
+				return "", err
+			}
+			continue
+		default:
+			fmt.Fprintf(p.out, "   Unknown choice %q\n", answer)
+			continue
+		}
+
+		if len(answer) == 1 && strings.ToUpper(answer) == answer {
+			p.all = choice
+		}
+		return choice, nil
+	}
+}
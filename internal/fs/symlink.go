@@ -0,0 +1,161 @@
+package fs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SymlinkPolicy selects how symbolic links found in the source are applied
+type SymlinkPolicy string
+
+const (
+	SymlinksPreserve SymlinkPolicy = "preserve" // Recreate the link in the destination
+	SymlinksFollow   SymlinkPolicy = "follow"   // Copy the file or directory the link points to
+	SymlinksSkip     SymlinkPolicy = "skip"     // Leave the link out
+)
+
+// SymlinkPolicies lists the valid symlink policies
+var SymlinkPolicies = []SymlinkPolicy{SymlinksPreserve, SymlinksFollow, SymlinksSkip}
+
+// ParseSymlinkPolicy parses a symlink policy name, where empty means follow
+func ParseSymlinkPolicy(name string) (SymlinkPolicy, error) {
+	if name == "" {
+		return SymlinksFollow, nil
+	}
+	for _, policy := range SymlinkPolicies {
+		if string(policy) == name {
+			return policy, nil
+		}
+	}
+	return "", fmt.Errorf("invalid symlink policy %q, expected one of %v", name, SymlinkPolicies)
+}
+
+// planSymlink adds the actions for src when it is a symbolic link and reports
+// whether it did. Followed links are left to the caller, which reads through them.
+func (p *planner) planSymlink(src, dest string) (bool, error) {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return true, fmt.Errorf("failed to get source file info %s: %w", src, err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		return false, nil
+	}
+
+	if p.symlinks == SymlinksSkip {
+		if rel, err := filepath.Rel(p.destDir, dest); err == nil {
+			p.skipped = append(p.skipped, filepath.ToSlash(rel))
+		}
+		return true, nil
+	}
+
+	target, resolved, err := p.linkTarget(src)
+	if err != nil {
+		return true, err
+	}
+
+	switch {
+	case p.symlinks == SymlinksFollow || p.symlinks == "":
+		if resolved == "" {
+			return true, fmt.Errorf("cannot follow symbolic link %s: %s does not exist", src, target)
+		}
+		if resolvedInfo, err := os.Stat(resolved); err == nil && resolvedInfo.IsDir() {
+			dir, err := filepath.EvalSymlinks(filepath.Dir(src))
+			if err == nil && within(resolved, dir) {
+				return true, fmt.Errorf("cannot follow symbolic link %s: it points to its own parent directory", src)
+			}
+		}
+		return false, nil
+	case p.link != LinkNone:
+		// Linking to the link itself keeps it resolving inside the checkout
+		return true, p.planLinkTo(src, info, dest)
+	default:
+		return true, p.planLink(src, target, info, dest)
+	}
+}
+
+// linkTarget returns the target of the symbolic link src, made relative when
+// it is an absolute path, and its resolved path, which is empty when the link
+// is dangling. Links pointing outside the source root are rejected.
+func (p *planner) linkTarget(src string) (string, string, error) {
+	target, err := os.Readlink(src)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read link %s: %w", src, err)
+	}
+
+	dir, err := filepath.EvalSymlinks(filepath.Dir(src))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to resolve path %s: %w", filepath.Dir(src), err)
+	}
+	abs := target
+	if !filepath.IsAbs(abs) {
+		abs = filepath.Join(dir, target)
+	}
+
+	resolved, err := filepath.EvalSymlinks(src)
+	if err != nil && !os.IsNotExist(err) {
+		return "", "", fmt.Errorf("failed to resolve link %s: %w", src, err)
+	}
+	checked := resolved
+	if checked == "" {
+		checked = filepath.Clean(abs)
+	}
+	if !within(p.root, checked) {
+		return "", "", fmt.Errorf("symbolic link %s points outside the repository: %s", src, target)
+	}
+
+	if filepath.IsAbs(target) {
+		if target, err = filepath.Rel(dir, abs); err != nil {
+			return "", "", fmt.Errorf("failed to resolve link %s: %w", src, err)
+		}
+	}
+	return target, resolved, nil
+}
+
+// warnDanglingLinks warns about preserved links whose target neither exists in
+// the destination nor is written by another action
+func warnDanglingLinks(actions []*FileAction) {
+	written := map[string]bool{}
+	for _, action := range actions {
+		for dir := action.Dest; !written[dir]; dir = filepath.Dir(dir) {
+			written[dir] = true
+			if dir == filepath.Dir(dir) {
+				break
+			}
+		}
+	}
+
+	for _, action := range actions {
+		// Links made by --link are absolute and point into the source
+		if action.Link == "" || filepath.IsAbs(action.Link) {
+			continue
+		}
+		target := filepath.Join(filepath.Dir(action.Dest), action.Link)
+		if _, err := os.Stat(target); err == nil || written[target] {
+			continue
+		}
+		fmt.Printf("⚠️  Link %s points to %s, which is not applied; use --symlinks=follow to copy its content\n", action.Path, action.Link)
+	}
+}
+
+// within reports whether path is root or below it
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && filepath.IsLocal(rel)
+}
+
+// sourceRoot returns the resolved directory symbolic links in src may point
+// into: root when given, otherwise src itself or the directory of a file
+func sourceRoot(src, root string) (string, error) {
+	if root == "" {
+		root = src
+		if info, err := os.Lstat(src); err == nil && !info.IsDir() {
+			root = filepath.Dir(src)
+		}
+	}
+	resolved, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve source directory %s: %w", root, err)
+	}
+	return resolved, nil
+}
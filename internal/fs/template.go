@@ -0,0 +1,35 @@
+package fs
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// templateSuffix marks source files rendered with text/template before they
+// are written. The suffix is stripped from the destination name.
+const templateSuffix = ".tmpl"
+
+// isTemplate reports whether the source file at path is a template. A file
+// named just .tmpl is not, since stripping the suffix would leave no name.
+func isTemplate(path string) bool {
+	name := filepath.Base(path)
+	return strings.HasSuffix(name, templateSuffix) && len(name) > len(templateSuffix)
+}
+
+// renderTemplate renders the template text with data. Missing keys are errors
+// so that a typo never ends up in a dotfile.
+func renderTemplate(text []byte, name string, data map[string]any) ([]byte, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(string(text))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", name, err)
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return nil, fmt.Errorf("failed to render template %s: %w", name, err)
+	}
+	return out.Bytes(), nil
+}
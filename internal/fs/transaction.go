@@ -0,0 +1,218 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ErrPartialApply is wrapped by errors returned when a failed apply could not
+// be rolled back completely
+var ErrPartialApply = errors.New("the destination may be partially updated")
+
+// stagedFile is content written next to its target, renamed into place on commit
+type stagedFile struct {
+	target    string // File replaced on commit
+	temp      string // Staged content
+	orig      string // Link to or copy of the original target, if it existed
+	committed bool
+}
+
+// transaction stages every write of an apply and commits them together, so
+// that a failure leaves the destination exactly as it was
+type transaction struct {
+	ctx   context.Context
+	files []*stagedFile
+	dirs  []string // Directories created while staging, parents first
+}
+
+// mkdirAll creates dir and its missing parents, remembering them for rollback
+func (t *transaction) mkdirAll(dir string) error {
+	var missing []string
+	for d := dir; d != filepath.Dir(d); d = filepath.Dir(d) {
+		if _, err := os.Lstat(d); err == nil {
+			break
+		}
+		missing = append(missing, d)
+	}
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		t.dirs = append(t.dirs, missing[i])
+	}
+	return nil
+}
+
+// stage writes the content of r to a temporary file next to target and
+// preserves the original target, if any, until the transaction ends
+func (t *transaction) stage(target string, r io.Reader, mode os.FileMode) error {
+	if err := t.mkdirAll(filepath.Dir(target)); err != nil {
+		return err
+	}
+
+	temp, err := writeTemp(t.ctx, target, r, mode)
+	if err != nil {
+		return err
+	}
+	return t.add(target, temp)
+}
+
+// stageLink creates a symbolic link to linkTarget next to target, replacing
+// target on commit
+func (t *transaction) stageLink(target, linkTarget string) error {
+	if err := t.mkdirAll(filepath.Dir(target)); err != nil {
+		return err
+	}
+
+	temp, err := tempPath(target, ".dotme-*.tmp")
+	if err != nil {
+		return err
+	}
+	if err := os.Symlink(linkTarget, temp); err != nil {
+		return err
+	}
+	return t.add(target, temp)
+}
+
+// add registers staged content for target and preserves the original target,
+// if any, until the transaction ends
+func (t *transaction) add(target, temp string) error {
+	file := &stagedFile{target: target, temp: temp}
+	t.files = append(t.files, file)
+
+	info, err := os.Lstat(target)
+	if err != nil || !(info.Mode().IsRegular() || info.Mode()&os.ModeSymlink != 0) {
+		return nil
+	}
+	if file.orig, err = preserve(t.ctx, target, info); err != nil {
+		return fmt.Errorf("failed to preserve %s: %w", target, err)
+	}
+	return nil
+}
+
+// commit renames every staged file into place, rolling back on the first failure
+func (t *transaction) commit() error {
+	if err := t.ctx.Err(); err != nil {
+		return t.abort(err)
+	}
+
+	for _, file := range t.files {
+		if err := os.Rename(file.temp, file.target); err != nil {
+			return t.abort(fmt.Errorf("failed to replace %s: %w", file.target, err))
+		}
+		file.committed = true
+	}
+
+	for _, file := range t.files {
+		if file.orig != "" {
+			os.Remove(file.orig)
+		}
+	}
+	return nil
+}
+
+// abort rolls back the transaction and returns err, marked as a partial
+// apply when the rollback fails
+func (t *transaction) abort(err error) error {
+	if rollbackErr := t.rollback(); rollbackErr != nil {
+		return fmt.Errorf("%v; rollback failed: %v: %w", err, rollbackErr, ErrPartialApply)
+	}
+	return err
+}
+
+// rollback restores the original targets, removes the files and directories
+// created by the transaction and deletes the staged content
+func (t *transaction) rollback() error {
+	var errs []error
+	for i := len(t.files) - 1; i >= 0; i-- {
+		file := t.files[i]
+		os.Remove(file.temp)
+		switch {
+		case !file.committed:
+			if file.orig != "" {
+				os.Remove(file.orig)
+			}
+		case file.orig != "":
+			if err := os.Rename(file.orig, file.target); err != nil {
+				errs = append(errs, fmt.Errorf("failed to restore %s: %w", file.target, err))
+			}
+		default:
+			if err := os.Remove(file.target); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, fmt.Errorf("failed to remove %s: %w", file.target, err))
+			}
+		}
+	}
+
+	for i := len(t.dirs) - 1; i >= 0; i-- {
+		os.Remove(t.dirs[i])
+	}
+	return errors.Join(errs...)
+}
+
+// writeTemp writes the content of r to a new temporary file next to path with
+// the given mode and returns its name
+func writeTemp(ctx context.Context, path string, r io.Reader, mode os.FileMode) (string, error) {
+	tempFile, err := os.CreateTemp(filepath.Dir(path), ".dotme-*.tmp")
+	if err != nil {
+		return "", err
+	}
+
+	_, err = io.Copy(tempFile, &contextReader{ctx: ctx, r: r})
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tempFile.Name(), mode.Perm())
+	}
+	if err != nil {
+		os.Remove(tempFile.Name())
+		return "", err
+	}
+	return tempFile.Name(), nil
+}
+
+// preserve keeps the current file or link at path under a temporary name.
+// Files are kept as a hard link when possible and as a copy otherwise.
+func preserve(ctx context.Context, path string, info os.FileInfo) (string, error) {
+	orig, err := tempPath(path, ".dotme-*.orig")
+	if err != nil {
+		return "", err
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		linkTarget, err := os.Readlink(path)
+		if err != nil {
+			return "", err
+		}
+		return orig, os.Symlink(linkTarget, orig)
+	}
+
+	if err := os.Link(path, orig); err == nil {
+		return orig, nil
+	}
+
+	original, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer original.Close()
+	return writeTemp(ctx, path, original, info.Mode().Perm())
+}
+
+// tempPath returns an unused temporary name next to path
+func tempPath(path, pattern string) (string, error) {
+	tempFile, err := os.CreateTemp(filepath.Dir(path), pattern)
+	if err != nil {
+		return "", err
+	}
+	tempFile.Close()
+	if err := os.Remove(tempFile.Name()); err != nil {
+		return "", err
+	}
+	return tempFile.Name(), nil
+}
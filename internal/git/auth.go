@@ -0,0 +1,257 @@
+package git
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// defaultSSHKeys lists the key files tried when no key or agent is available
+var defaultSSHKeys = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// credentialHelperTimeout bounds the time spent waiting for a git credential helper
+const credentialHelperTimeout = 10 * time.Second
+
+// resolveAuth selects the authentication method for a repository URL and
+// returns it with a description for verbose output. A nil method means no
+// credentials are sent, which is the case for public repositories and local paths.
+func resolveAuth(ctx context.Context, repoURL string, options *CloneOptions) (transport.AuthMethod, string, error) {
+	endpoint, err := transport.NewEndpoint(repoURL)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid repository URL %s: %w", repoURL, err)
+	}
+
+	switch endpoint.Protocol {
+	case "ssh":
+		return sshAuth(endpoint, options.SSHKey)
+	case "http", "https":
+		return httpAuth(ctx, endpoint)
+	default:
+		return nil, "none", nil
+	}
+}
+
+// sshAuth tries an explicit key file, the SSH agent and the default key files, in that order
+func sshAuth(endpoint *transport.Endpoint, keyFile string) (transport.AuthMethod, string, error) {
+	user := endpoint.User
+	if user == "" {
+		user = "git"
+	}
+
+	if keyFile == "" {
+		keyFile = os.Getenv("DOTME_SSH_KEY")
+	}
+	if keyFile != "" {
+		auth, err := publicKeysFromFile(user, keyFile)
+		if err != nil {
+			return nil, "", err
+		}
+		return auth, fmt.Sprintf("SSH key %s", keyFile), nil
+	}
+
+	if os.Getenv("SSH_AUTH_SOCK") != "" {
+		if auth, err := ssh.NewSSHAgentAuth(user); err == nil {
+			return auth, "SSH agent", nil
+		}
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, "none", nil
+	}
+	for _, name := range defaultSSHKeys {
+		path := filepath.Join(homeDir, ".ssh", name)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		auth, err := publicKeysFromFile(user, path)
+		if err != nil {
+			return nil, "", err
+		}
+		return auth, fmt.Sprintf("SSH key %s", path), nil
+	}
+
+	return nil, "none", nil
+}
+
+// publicKeysFromFile loads a private key, asking for its passphrase if it is encrypted
+func publicKeysFromFile(user, keyFile string) (transport.AuthMethod, error) {
+	pemBytes, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SSH key %s: %w", keyFile, err)
+	}
+
+	passphrase := ""
+	var missing *gossh.PassphraseMissingError
+	if _, err := gossh.ParsePrivateKey(pemBytes); errors.As(err, &missing) {
+		passphrase, err = sshPassphrase(keyFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	auth, err := ssh.NewPublicKeys(user, pemBytes, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load SSH key %s: %w", keyFile, err)
+	}
+	return auth, nil
+}
+
+// sshPassphrase returns the passphrase of an encrypted key from the
+// environment or by prompting on the terminal
+func sshPassphrase(keyFile string) (string, error) {
+	if passphrase := os.Getenv("DOTME_SSH_PASSPHRASE"); passphrase != "" {
+		return passphrase, nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("SSH key %s is encrypted; set DOTME_SSH_PASSPHRASE or run dotme in a terminal", keyFile)
+	}
+
+	fmt.Fprintf(os.Stderr, "🔑 Enter passphrase for %s: ", keyFile)
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+
+	return string(passphrase), nil
+}
+
+// httpAuth tries credentials embedded in the URL, tokens from the environment,
+// ~/.netrc and the git credential helper, in that order. Only credentials
+// embedded in the URL are used over plain HTTP.
+func httpAuth(ctx context.Context, endpoint *transport.Endpoint) (transport.AuthMethod, string, error) {
+	if endpoint.User != "" {
+		// go-git uses credentials embedded in the URL on its own
+		return nil, "credentials from URL", nil
+	}
+	if endpoint.Protocol != "https" {
+		return nil, "none", nil
+	}
+
+	if token, variable := tokenFromEnv(endpoint); token != "" {
+		return &http.BasicAuth{Username: tokenUsername(endpoint.Host), Password: token},
+			fmt.Sprintf("token from $%s", variable), nil
+	}
+
+	login, password, found, err := netrcCredentials(endpoint.Host)
+	if err != nil {
+		return nil, "", err
+	}
+	if found {
+		return &http.BasicAuth{Username: login, Password: password}, "~/.netrc", nil
+	}
+
+	if username, password, ok := credentialHelper(ctx, endpoint); ok {
+		return &http.BasicAuth{Username: username, Password: password}, "git credential helper", nil
+	}
+
+	return nil, "none", nil
+}
+
+// tokenFromEnv returns an access token for the endpoint from the environment
+// and the name of the variable it was read from. DOTME_GIT_TOKEN is only sent
+// to the hosts in DOTME_GIT_TOKEN_HOSTS when set.
+func tokenFromEnv(endpoint *transport.Endpoint) (string, string) {
+	host := strings.ToLower(endpoint.Host)
+	var variables []string
+	if tokenHostAllowed(host) {
+		variables = append(variables, "DOTME_GIT_TOKEN")
+	}
+	switch host {
+	case "github.com":
+		variables = append(variables, "GITHUB_TOKEN", "GH_TOKEN")
+	case "gitlab.com":
+		variables = append(variables, "GITLAB_TOKEN")
+	}
+
+	for _, variable := range variables {
+		if token := os.Getenv(variable); token != "" {
+			return token, variable
+		}
+	}
+	return "", ""
+}
+
+// tokenHostAllowed reports whether DOTME_GIT_TOKEN may be sent to host, which
+// is any host unless DOTME_GIT_TOKEN_HOSTS lists them, separated by commas
+func tokenHostAllowed(host string) bool {
+	hosts := os.Getenv("DOTME_GIT_TOKEN_HOSTS")
+	if hosts == "" {
+		return true
+	}
+	for _, allowed := range strings.Split(hosts, ",") {
+		if strings.EqualFold(strings.TrimSpace(allowed), host) {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenUsername returns the user name sent along with an access token
+func tokenUsername(host string) string {
+	if username := os.Getenv("DOTME_GIT_USERNAME"); username != "" {
+		return username
+	}
+	if strings.ToLower(host) == "github.com" {
+		return "x-access-token"
+	}
+	return "oauth2"
+}
+
+// credentialHelper asks the configured git credential helper for credentials.
+// Terminal prompts are disabled so that only stored credentials are returned.
+func credentialHelper(ctx context.Context, endpoint *transport.Endpoint) (string, string, bool) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return "", "", false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, credentialHelperTimeout)
+	defer cancel()
+
+	host := endpoint.Host
+	if endpoint.Port != 0 {
+		host = fmt.Sprintf("%s:%d", endpoint.Host, endpoint.Port)
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "credential", "fill")
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GCM_INTERACTIVE=never")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("protocol=%s\nhost=%s\npath=%s\n\n",
+		endpoint.Protocol, host, strings.TrimPrefix(endpoint.Path, "/")))
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", "", false
+	}
+
+	var username, password string
+	scanner := bufio.NewScanner(strings.NewReader(string(output)))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "username":
+			username = value
+		case "password":
+			password = value
+		}
+	}
+
+	return username, password, password != ""
+}
@@ -0,0 +1,435 @@
+package git
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+
+	"github.com/rsvinicius/dotme/internal/alias"
+)
+
+const (
+	cacheRepoDir   = "repo"       // Name of the clone directory inside a cache entry
+	cacheEntryFile = "entry.json" // Name of the metadata file inside a cache entry
+)
+
+// ErrNotCached is returned in offline mode when the repository has never been cached
+var ErrNotCached = errors.New("repository is not available in the cache")
+
+// unsafeNameChars matches characters that are not kept in cache directory names
+var unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// CacheEntry describes a repository clone kept in the cache
+type CacheEntry struct {
+	URL       string    `json:"url"`           // Repository URL the clone was made from
+	Ref       string    `json:"ref,omitempty"` // Ref requested by the last run
+	Commit    string    `json:"commit"`        // Commit checked out by the last run
+	FetchedAt time.Time `json:"fetched_at"`    // Time of the last clone or fetch
+
+	// DefaultCommit is the commit of the remote default branch as of the last
+	// fetch without a ref, used to apply the default branch in offline mode
+	DefaultCommit string `json:"default_commit,omitempty"`
+
+	Dir  string `json:"-"` // Directory of the cache entry
+	Size int64  `json:"-"` // Disk usage of the cache entry in bytes
+}
+
+// GetCacheDir returns the directory holding cached repository clones
+func GetCacheDir() (string, error) {
+	configDir, err := alias.GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	cacheDir := filepath.Join(configDir, "cache")
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	return cacheDir, nil
+}
+
+// NormalizeURL returns a canonical form of a repository URL so that equivalent
+// spellings (trailing slash, .git suffix, case of scheme and host) share a cache entry
+func NormalizeURL(repoURL string) string {
+	normalized := strings.TrimSpace(repoURL)
+	normalized = strings.TrimRight(normalized, "/")
+	normalized = strings.TrimSuffix(normalized, ".git")
+
+	if u, err := url.Parse(normalized); err == nil && u.Scheme != "" && u.Host != "" {
+		u.Scheme = strings.ToLower(u.Scheme)
+		u.Host = strings.ToLower(u.Host)
+		normalized = u.String()
+	}
+
+	return normalized
+}
+
+// cacheKey returns the directory name of the cache entry for a repository URL.
+// The name starts with the repository name for readability and ends with a
+// hash of the normalized URL to keep it unique.
+func cacheKey(repoURL string) string {
+	sum := sha256.Sum256([]byte(NormalizeURL(repoURL)))
+	return RepoName(repoURL) + "-" + hex.EncodeToString(sum[:6])
+}
+
+// RepoName returns the name of a repository, the last element of its
+// normalized URL made safe for file names, or "repo"
+func RepoName(repoURL string) string {
+	name := path.Base(strings.ReplaceAll(filepath.ToSlash(NormalizeURL(repoURL)), ":", "/"))
+	name = strings.Trim(unsafeNameChars.ReplaceAllString(name, "-"), "-.")
+	if name == "" {
+		return "repo"
+	}
+	return name
+}
+
+// persistentClone locates a clone that is kept between runs along with its metadata
+type persistentClone struct {
+	name      string // Description used in messages
+	dir       string // Directory removed when the first clone fails
+	repoDir   string // Working tree of the clone
+	entryFile string // Metadata file of the clone
+	track     bool   // Check out branches as local branches tracking the remote instead of detached commits
+}
+
+// cloneCached checks out the requested ref in the cached clone of the
+// repository, fetching only what is missing or cloning it on first use
+func cloneCached(ctx context.Context, repoURL string, options *CloneOptions, auth transport.AuthMethod) (*Repository, error) {
+	cacheDir, err := GetCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	entryDir := filepath.Join(cacheDir, cacheKey(repoURL))
+
+	return clonePersistent(ctx, persistentClone{
+		name:      "cached repository",
+		dir:       entryDir,
+		repoDir:   filepath.Join(entryDir, cacheRepoDir),
+		entryFile: filepath.Join(entryDir, cacheEntryFile),
+	}, repoURL, options, auth)
+}
+
+// clonePersistent checks out the requested ref in a persistent clone,
+// fetching only what is missing or cloning it on first use. The clone is
+// locked against other dotme processes until it is checked out.
+func clonePersistent(ctx context.Context, pc persistentClone, repoURL string, options *CloneOptions, auth transport.AuthMethod) (*Repository, error) {
+	lock, err := lockEntry(ctx, pc.dir, pc.name)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.unlock()
+
+	repoDir := pc.repoDir
+	if options.Offline {
+		return openOffline(ctx, pc, options)
+	}
+
+	var hash plumbing.Hash
+	var refName plumbing.ReferenceName
+	var remoteErr *remoteError
+	r, err := git.PlainOpen(repoDir)
+	if err == nil {
+		fmt.Printf("🔄 Updating %s: %s\n", pc.name, repoURL)
+		hash, refName, err = update(ctx, r, repoURL, options, auth)
+		switch {
+		case ctx.Err() != nil:
+			return nil, ctx.Err()
+		case errors.Is(err, errFullCloneRequired):
+			fmt.Printf("ℹ️  %s is shallow, cloning full history\n", pc.name)
+			r = nil
+		case errors.As(err, &remoteErr) && isNetworkError(err):
+			fmt.Printf("⚠️  Could not reach the repository (%s), falling back to the cached copy\n", err)
+			return openOffline(ctx, pc, options)
+		case err != nil:
+			return nil, err
+		default:
+			fmt.Printf("✅ Updated %s\n", pc.name)
+		}
+	}
+
+	if r == nil {
+		if err := os.RemoveAll(repoDir); err != nil {
+			return nil, fmt.Errorf("failed to remove %s: %w", pc.name, err)
+		}
+		if err := os.MkdirAll(repoDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create %s: %w", pc.name, err)
+		}
+
+		fmt.Printf("🔄 Cloning repository: %s\n", repoURL)
+		r, err = clone(ctx, repoDir, repoURL, options, auth)
+		if err != nil {
+			os.RemoveAll(pc.dir)
+			return nil, fmt.Errorf("failed to clone repository: %w", err)
+		}
+
+		hash, err = clonedRevision(r, options.Ref)
+		if err != nil {
+			return nil, err
+		}
+		refName = remoteBranch(r, options.Ref, hash)
+	}
+
+	if pc.track {
+		err = checkoutBranch(r, refName, hash)
+	} else {
+		err = checkout(r, hash)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := updateSubmodules(ctx, r, options, auth, false); err != nil {
+		return nil, err
+	}
+
+	// Keep the default branch commit of earlier runs when a ref was requested
+	entry, err := readCacheEntry(pc.entryFile)
+	if err != nil {
+		entry = CacheEntry{}
+	}
+	entry.URL = repoURL
+	entry.Ref = options.Ref
+	entry.Commit = hash.String()
+	entry.FetchedAt = time.Now()
+	if options.Ref == "" {
+		entry.DefaultCommit = hash.String()
+	}
+	if err := writeCacheEntry(pc.entryFile, entry); err != nil {
+		return nil, err
+	}
+
+	return &Repository{
+		Dir:       repoDir,
+		Ref:       options.Ref,
+		Commit:    hash.String(),
+		FetchedAt: entry.FetchedAt,
+		remoteURL: repoURL,
+	}, nil
+}
+
+// openOffline checks out the requested ref from a persistent clone without
+// contacting the remote
+func openOffline(ctx context.Context, pc persistentClone, options *CloneOptions) (*Repository, error) {
+	r, err := git.PlainOpen(pc.repoDir)
+	if err != nil {
+		return nil, ErrNotCached
+	}
+	entry, err := readCacheEntry(pc.entryFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var hash plumbing.Hash
+	if options.Ref == "" {
+		if entry.DefaultCommit == "" {
+			return nil, fmt.Errorf("the default branch is not available in the cache, use --ref to select a cached ref")
+		}
+		hash = plumbing.NewHash(entry.DefaultCommit)
+	} else {
+		hash, err = resolveRef(r, options.Ref)
+		if err != nil {
+			return nil, fmt.Errorf("%w in the cached copy", err)
+		}
+	}
+
+	if pc.track {
+		err = checkoutBranch(r, remoteBranch(r, options.Ref, hash), hash)
+	} else {
+		err = checkout(r, hash)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := updateSubmodules(ctx, r, options, nil, true); err != nil {
+		return nil, err
+	}
+
+	entry.Ref = options.Ref
+	entry.Commit = hash.String()
+	if err := writeCacheEntry(pc.entryFile, entry); err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("📴 Using cached copy of %s fetched at %s\n", entry.URL, entry.FetchedAt.Format(time.RFC822))
+
+	return &Repository{
+		Dir:       pc.repoDir,
+		Ref:       options.Ref,
+		Commit:    hash.String(),
+		Offline:   true,
+		FetchedAt: entry.FetchedAt,
+		remoteURL: entry.URL,
+	}, nil
+}
+
+// writeCacheEntry saves the metadata of a persistent clone to entryFile
+func writeCacheEntry(entryFile string, entry CacheEntry) error {
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache entry: %w", err)
+	}
+
+	if err := os.WriteFile(entryFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+
+	return nil
+}
+
+// readCacheEntry loads the metadata of a persistent clone from entryFile
+func readCacheEntry(entryFile string) (CacheEntry, error) {
+	data, err := os.ReadFile(entryFile)
+	if err != nil {
+		return CacheEntry{}, fmt.Errorf("failed to read cache entry: %w", err)
+	}
+
+	var entry CacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return CacheEntry{}, fmt.Errorf("failed to parse cache entry: %w", err)
+	}
+
+	return entry, nil
+}
+
+// ListCache returns the cached repositories sorted by URL. Entries without
+// readable metadata are returned with only their directory set.
+func ListCache() ([]CacheEntry, error) {
+	cacheDir, err := GetCacheDir()
+	if err != nil {
+		return nil, err
+	}
+
+	dirEntries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache directory: %w", err)
+	}
+
+	var entries []CacheEntry
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.IsDir() {
+			continue
+		}
+
+		entryDir := filepath.Join(cacheDir, dirEntry.Name())
+		entry, err := readCacheEntry(filepath.Join(entryDir, cacheEntryFile))
+		if err != nil {
+			entry = CacheEntry{}
+		}
+		entry.Dir = entryDir
+		entry.Size = dirSize(entryDir)
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].URL < entries[j].URL
+	})
+
+	return entries, nil
+}
+
+// PruneCache removes cached repositories that were not fetched within maxAge,
+// along with entries whose metadata is missing, and returns the removed
+// entries. Entries in use by another dotme process are kept.
+func PruneCache(maxAge time.Duration) ([]CacheEntry, error) {
+	entries, err := ListCache()
+	if err != nil {
+		return nil, err
+	}
+
+	var pruned []CacheEntry
+	cutoff := time.Now().Add(-maxAge)
+	for _, entry := range entries {
+		if entry.URL != "" && entry.FetchedAt.After(cutoff) {
+			continue
+		}
+		removed, err := removeCacheEntry(entry)
+		if err != nil {
+			return pruned, err
+		}
+		if removed {
+			pruned = append(pruned, entry)
+		}
+	}
+
+	return pruned, nil
+}
+
+// ClearCache removes every cached repository. Entries in use by another
+// dotme process are kept and reported in the returned error.
+func ClearCache() error {
+	entries, err := ListCache()
+	if err != nil {
+		return err
+	}
+
+	var inUse []string
+	for _, entry := range entries {
+		removed, err := removeCacheEntry(entry)
+		if err != nil {
+			return err
+		}
+		if !removed {
+			name := entry.URL
+			if name == "" {
+				name = filepath.Base(entry.Dir)
+			}
+			inUse = append(inUse, name)
+		}
+	}
+	if len(inUse) > 0 {
+		return fmt.Errorf("kept %d cached repositories %s: %s", len(inUse), errLocked, strings.Join(inUse, ", "))
+	}
+
+	return nil
+}
+
+// removeCacheEntry removes a cached repository unless another dotme process
+// holds its lock, and reports whether it was removed
+func removeCacheEntry(entry CacheEntry) (bool, error) {
+	lock, err := tryLockEntry(entry.Dir)
+	if errors.Is(err, errLocked) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer lock.unlock()
+
+	if err := os.RemoveAll(entry.Dir); err != nil {
+		return false, fmt.Errorf("failed to remove cache entry %s: %w", entry.Dir, err)
+	}
+	return true, nil
+}
+
+// dirSize returns the total size of the regular files below dir
+func dirSize(dir string) int64 {
+	var size int64
+	_ = filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,164 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+
+	"github.com/rsvinicius/dotme/internal/alias"
+)
+
+// checkoutEntryFile is the name of the metadata file inside the .git directory of a checkout
+const checkoutEntryFile = "dotme.json"
+
+// GetReposDir returns the directory holding the persistent checkouts that linked dotfiles point to
+func GetReposDir() (string, error) {
+	configDir, err := alias.GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	reposDir := filepath.Join(configDir, "repos")
+	if err := os.MkdirAll(reposDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create repos directory: %w", err)
+	}
+
+	return reposDir, nil
+}
+
+// CheckoutDir returns the persistent checkout directory of a repository,
+// named after name when given (usually an alias) and after the URL otherwise
+func CheckoutDir(repoURL, name string) (string, error) {
+	reposDir, err := GetReposDir()
+	if err != nil {
+		return "", err
+	}
+
+	if name == "" {
+		return filepath.Join(reposDir, cacheKey(repoURL)), nil
+	}
+	safeName := strings.Trim(unsafeNameChars.ReplaceAllString(name, "-"), "-.")
+	if safeName == "" {
+		return "", fmt.Errorf("invalid checkout name %q", name)
+	}
+	return filepath.Join(reposDir, safeName), nil
+}
+
+// cloneCheckout checks out the requested ref in the persistent checkout at
+// dir. Checkouts are full clones since they may be edited and committed to:
+// branches are checked out as local branches tracking the remote, and they
+// are never updated while they have local changes or unpushed commits.
+func cloneCheckout(ctx context.Context, dir, repoURL string, options *CloneOptions, auth transport.AuthMethod) (*Repository, error) {
+	entryFile := filepath.Join(dir, git.GitDirName, checkoutEntryFile)
+
+	if r, err := git.PlainOpen(dir); err == nil {
+		if entry, err := readCacheEntry(entryFile); err == nil && NormalizeURL(entry.URL) != NormalizeURL(repoURL) {
+			return nil, fmt.Errorf("%s is a checkout of %s, not %s", dir, entry.URL, repoURL)
+		}
+
+		worktree, err := r.Worktree()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open worktree: %w", err)
+		}
+		status, err := worktree.Status()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get status of %s: %w", dir, err)
+		}
+		if !status.IsClean() {
+			return nil, fmt.Errorf("%s has local changes, commit or discard them before updating", dir)
+		}
+	} else if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("%s exists and is not a git checkout", dir)
+	}
+
+	fullClone := *options
+	fullClone.FullClone = true
+	return clonePersistent(ctx, persistentClone{
+		name:      "checkout",
+		dir:       dir,
+		repoDir:   dir,
+		entryFile: entryFile,
+		track:     true,
+	}, repoURL, &fullClone, auth)
+}
+
+// remoteBranch returns the branch named by ref, or the current branch for an
+// empty ref, when its remote-tracking branch is at hash. Tags, commits and
+// branches that do not match give an empty name.
+func remoteBranch(r *git.Repository, ref string, hash plumbing.Hash) plumbing.ReferenceName {
+	name := strings.TrimPrefix(ref, "refs/heads/")
+	if name == "" {
+		head, err := r.Reference(plumbing.HEAD, false)
+		if err != nil || !head.Target().IsBranch() {
+			return ""
+		}
+		name = head.Target().Short()
+	}
+
+	remote, err := r.Reference(plumbing.NewRemoteReferenceName(git.DefaultRemoteName, name), true)
+	if err != nil || remote.Hash() != hash {
+		return ""
+	}
+	return plumbing.NewBranchReferenceName(name)
+}
+
+// checkoutBranch checks out the commit hash of the remote branch refName as
+// the local branch of the same name, fast-forwarding it and setting it to
+// track the remote. A local branch with commits that are not on the remote is
+// never moved. Tags and commits are checked out detached.
+func checkoutBranch(r *git.Repository, refName plumbing.ReferenceName, hash plumbing.Hash) error {
+	if !refName.IsBranch() {
+		return checkout(r, hash)
+	}
+
+	if local, err := r.Reference(refName, true); err == nil && local.Hash() != hash {
+		current, err := r.CommitObject(local.Hash())
+		if err != nil {
+			return fmt.Errorf("failed to read commit %s: %w", local.Hash(), err)
+		}
+		target, err := r.CommitObject(hash)
+		if err != nil {
+			return fmt.Errorf("failed to read commit %s: %w", hash, err)
+		}
+		ancestor, err := current.IsAncestor(target)
+		if err != nil {
+			return fmt.Errorf("failed to compare %s with the remote: %w", refName.Short(), err)
+		}
+		if !ancestor {
+			return fmt.Errorf("branch %s has commits that are not on the remote, push or reset them before updating", refName.Short())
+		}
+	}
+
+	if err := r.Storer.SetReference(plumbing.NewHashReference(refName, hash)); err != nil {
+		return fmt.Errorf("failed to update branch %s: %w", refName.Short(), err)
+	}
+	cfg, err := r.Config()
+	if err != nil {
+		return fmt.Errorf("failed to read repository config: %w", err)
+	}
+	if _, ok := cfg.Branches[refName.Short()]; !ok {
+		cfg.Branches[refName.Short()] = &config.Branch{Name: refName.Short(), Remote: git.DefaultRemoteName, Merge: refName}
+		if err := r.SetConfig(cfg); err != nil {
+			return fmt.Errorf("failed to set upstream of %s: %w", refName.Short(), err)
+		}
+	}
+
+	worktree, err := r.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to open worktree: %w", err)
+	}
+	if err := worktree.Checkout(&git.CheckoutOptions{Branch: refName, Force: true}); err != nil {
+		return fmt.Errorf("failed to check out branch %s: %w", refName.Short(), err)
+	}
+	if err := worktree.Clean(&git.CleanOptions{Dir: true}); err != nil {
+		return fmt.Errorf("failed to clean worktree: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,346 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	nethttp "net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	formatconfig "github.com/go-git/go-git/v5/plumbing/format/config"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// lfsMediaType is the content type of Git LFS batch API requests and responses
+const lfsMediaType = "application/vnd.git-lfs+json"
+
+// lfsTimeout bounds the time spent on a single Git LFS request
+const lfsTimeout = 10 * time.Minute
+
+// lfsBatchRequest is the body of a Git LFS batch API request
+type lfsBatchRequest struct {
+	Operation string      `json:"operation"`
+	Transfers []string    `json:"transfers"`
+	Objects   []lfsObject `json:"objects"`
+}
+
+// lfsObject is an object in a Git LFS batch API request or response
+type lfsObject struct {
+	Oid     string               `json:"oid"`
+	Size    int64                `json:"size"`
+	Actions map[string]lfsAction `json:"actions,omitempty"`
+	Error   *lfsObjectError      `json:"error,omitempty"`
+}
+
+// lfsAction describes where an object is transferred from
+type lfsAction struct {
+	Href   string            `json:"href"`
+	Header map[string]string `json:"header,omitempty"`
+}
+
+// lfsObjectError is a per-object error of a Git LFS batch API response
+type lfsObjectError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// lfsBatchResponse is the body of a Git LFS batch API response
+type lfsBatchResponse struct {
+	Objects []lfsObject `json:"objects"`
+}
+
+// FetchLFSObject writes the content of a Git LFS object to dst. Objects found
+// in the LFS store of the clone are used directly; others are downloaded from
+// the LFS endpoint of the remote and kept in the store for later runs.
+func (r *Repository) FetchLFSObject(ctx context.Context, oid string, size int64, dst string) error {
+	if len(oid) != sha256.Size*2 {
+		return fmt.Errorf("invalid Git LFS object id %q", oid)
+	}
+
+	stored := lfsObjectPath(filepath.Join(r.Dir, ".git", "lfs", "objects"), oid)
+	if verifyLFSObject(stored, oid, size) == nil {
+		return copyLFSObject(stored, dst)
+	}
+
+	if r.remoteURL == "" {
+		return fmt.Errorf("object %s is not in the local Git LFS store", oid)
+	}
+	if r.Offline {
+		return fmt.Errorf("object %s is not in the cached copy", oid)
+	}
+
+	endpoint, trusted, err := r.lfsEndpoint()
+	if err != nil {
+		return err
+	}
+
+	// Local remotes keep their objects in their own LFS store
+	if endpoint.Scheme == "file" {
+		for _, store := range []string{filepath.Join(endpoint.Path, ".git", "lfs", "objects"), filepath.Join(endpoint.Path, "lfs", "objects")} {
+			path := lfsObjectPath(store, oid)
+			if verifyLFSObject(path, oid, size) == nil {
+				return copyLFSObject(path, dst)
+			}
+		}
+		return fmt.Errorf("object %s is not in the Git LFS store of %s", oid, endpoint.Path)
+	}
+
+	if err := downloadLFSObject(ctx, endpoint, trusted, oid, size, stored); err != nil {
+		return err
+	}
+	return copyLFSObject(stored, dst)
+}
+
+// lfsEndpoint returns the Git LFS endpoint of the repository, taken from the
+// lfs.url setting of .lfsconfig or derived from the remote URL, and whether
+// credentials for the remote may be sent to it. An lfs.url comes from the
+// repository content, so it only gets credentials when it uses HTTPS on the
+// host of the remote.
+func (r *Repository) lfsEndpoint() (*url.URL, bool, error) {
+	endpoint, err := transport.NewEndpoint(r.remoteURL)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid repository URL %s: %w", r.remoteURL, err)
+	}
+
+	if file, err := os.Open(filepath.Join(r.Dir, ".lfsconfig")); err == nil {
+		defer file.Close()
+		config := formatconfig.New()
+		if err := formatconfig.NewDecoder(file).Decode(config); err == nil {
+			if lfsURL := config.Section("lfs").Option("url"); lfsURL != "" {
+				parsed, err := url.Parse(lfsURL)
+				if err != nil {
+					return nil, false, fmt.Errorf("invalid Git LFS endpoint %s: %w", lfsURL, err)
+				}
+				return parsed, sameLFSHost(parsed, endpoint), nil
+			}
+		}
+	}
+
+	if endpoint.Protocol == "file" {
+		return &url.URL{Scheme: "file", Path: endpoint.Path}, false, nil
+	}
+
+	// SSH remotes are served over HTTPS by the same host
+	lfsURL := &url.URL{Scheme: "https", Host: endpoint.Host}
+	if endpoint.Protocol == "http" || endpoint.Protocol == "https" {
+		lfsURL.Scheme = endpoint.Protocol
+		if endpoint.Port != 0 {
+			lfsURL.Host = fmt.Sprintf("%s:%d", endpoint.Host, endpoint.Port)
+		}
+		if endpoint.User != "" {
+			lfsURL.User = url.UserPassword(endpoint.User, endpoint.Password)
+		}
+	}
+
+	path := "/" + strings.Trim(endpoint.Path, "/")
+	if !strings.HasSuffix(path, ".git") {
+		path += ".git"
+	}
+	lfsURL.Path = path + "/info/lfs"
+	return lfsURL, true, nil
+}
+
+// sameLFSHost reports whether the LFS endpoint is served over HTTPS by the host
+// of the remote. The port must match too, except for SSH remotes.
+func sameLFSHost(lfsURL *url.URL, remote *transport.Endpoint) bool {
+	if lfsURL.Scheme != "https" || !strings.EqualFold(lfsURL.Hostname(), remote.Host) {
+		return false
+	}
+	switch remote.Protocol {
+	case "ssh":
+		return true
+	case "https":
+		port, remotePort := lfsURL.Port(), remote.Port
+		if port == "" {
+			port = "443"
+		}
+		if remotePort == 0 {
+			remotePort = 443
+		}
+		return port == strconv.Itoa(remotePort)
+	default:
+		return false
+	}
+}
+
+// downloadLFSObject downloads an object through the Git LFS batch API into
+// the store path, verifying its size and checksum. Credentials for the remote
+// are only sent when trusted is set.
+func downloadLFSObject(ctx context.Context, endpoint *url.URL, trusted bool, oid string, size int64, path string) error {
+	body, err := json.Marshal(lfsBatchRequest{
+		Operation: "download",
+		Transfers: []string{"basic"},
+		Objects:   []lfsObject{{Oid: oid, Size: size}},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := nethttp.NewRequestWithContext(ctx, nethttp.MethodPost, strings.TrimSuffix(endpoint.String(), "/")+"/objects/batch", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create Git LFS request: %w", err)
+	}
+	req.Header.Set("Accept", lfsMediaType)
+	req.Header.Set("Content-Type", lfsMediaType)
+	if endpoint.User == nil && trusted {
+		if err := setLFSAuth(ctx, req, endpoint); err != nil {
+			return err
+		}
+	}
+
+	client := &nethttp.Client{Timeout: lfsTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to contact Git LFS endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == nethttp.StatusUnauthorized || resp.StatusCode == nethttp.StatusForbidden:
+		return fmt.Errorf("Git LFS endpoint %s requires authentication (HTTP %d)", endpoint.Redacted(), resp.StatusCode)
+	case resp.StatusCode != nethttp.StatusOK:
+		return fmt.Errorf("Git LFS endpoint %s returned HTTP %d", endpoint.Redacted(), resp.StatusCode)
+	}
+
+	var batch lfsBatchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&batch); err != nil {
+		return fmt.Errorf("failed to decode Git LFS response: %w", err)
+	}
+
+	for _, object := range batch.Objects {
+		if object.Oid != oid {
+			continue
+		}
+		if object.Error != nil {
+			return fmt.Errorf("Git LFS endpoint refused object: %s (%d)", object.Error.Message, object.Error.Code)
+		}
+		action, ok := object.Actions["download"]
+		if !ok {
+			return fmt.Errorf("Git LFS endpoint returned no download action")
+		}
+		return downloadLFSAction(ctx, client, action, oid, size, path)
+	}
+
+	return fmt.Errorf("Git LFS endpoint did not return the object")
+}
+
+// setLFSAuth adds the HTTP credentials for the LFS endpoint to the request.
+// Credentials are never sent to endpoints not using HTTPS.
+func setLFSAuth(ctx context.Context, req *nethttp.Request, endpoint *url.URL) error {
+	if endpoint.Scheme != "https" {
+		return nil
+	}
+	transportEndpoint, err := transport.NewEndpoint(endpoint.String())
+	if err != nil {
+		return fmt.Errorf("invalid Git LFS endpoint %s: %w", endpoint.Redacted(), err)
+	}
+	auth, _, err := httpAuth(ctx, transportEndpoint)
+	if err != nil {
+		return err
+	}
+	if basic, ok := auth.(*http.BasicAuth); ok {
+		req.SetBasicAuth(basic.Username, basic.Password)
+	}
+	return nil
+}
+
+// downloadLFSAction downloads an object from the location given by a batch
+// API download action
+func downloadLFSAction(ctx context.Context, client *nethttp.Client, action lfsAction, oid string, size int64, path string) error {
+	req, err := nethttp.NewRequestWithContext(ctx, nethttp.MethodGet, action.Href, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create Git LFS download request: %w", err)
+	}
+	for key, value := range action.Header {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download Git LFS object: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != nethttp.StatusOK {
+		return fmt.Errorf("failed to download Git LFS object: HTTP %d", resp.StatusCode)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create Git LFS store: %w", err)
+	}
+	tempFile, err := os.CreateTemp(filepath.Dir(path), oid+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create Git LFS object: %w", err)
+	}
+	defer os.Remove(tempFile.Name())
+
+	// Read one byte more than expected to detect oversized objects
+	_, err = io.Copy(tempFile, io.LimitReader(resp.Body, size+1))
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download Git LFS object: %w", err)
+	}
+
+	if err := verifyLFSObject(tempFile.Name(), oid, size); err != nil {
+		return err
+	}
+	return os.Rename(tempFile.Name(), path)
+}
+
+// lfsObjectPath returns the location of an object in a Git LFS store
+func lfsObjectPath(store, oid string) string {
+	return filepath.Join(store, oid[0:2], oid[2:4], oid)
+}
+
+// verifyLFSObject checks that the file at path has the size and SHA-256 of the object
+func verifyLFSObject(path, oid string, size int64) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	written, err := io.Copy(hash, file)
+	if err != nil {
+		return err
+	}
+	if written != size {
+		return fmt.Errorf("object %s has size %d, expected %d", oid, written, size)
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != oid {
+		return errors.New("object checksum does not match its pointer")
+	}
+	return nil
+}
+
+// copyLFSObject copies an object from a Git LFS store to dst
+func copyLFSObject(src, dst string) error {
+	source, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	dest, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dest, source); err != nil {
+		dest.Close()
+		return err
+	}
+	return dest.Close()
+}
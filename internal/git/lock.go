@@ -0,0 +1,112 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	lockSuffix          = ".lock"                // Appended to the directory of a persistent clone to name its lock file
+	lockPollInterval    = 200 * time.Millisecond // Time between attempts to take a lock held by another process
+	lockRefreshInterval = 10 * time.Second       // Time between updates of the modification time of a held lock
+	lockStaleAfter      = time.Minute            // Age after which a lock that is not refreshed was left behind by a process that died
+)
+
+// errLocked is returned when a persistent clone is in use by another dotme process
+var errLocked = errors.New("in use by another dotme process")
+
+// entryLock is an exclusive lock on a persistent clone, held through a lock
+// file next to its directory. The lock file is refreshed while it is held so
+// that other processes can tell it from one left behind by a process that died.
+type entryLock struct {
+	path string
+	stop chan struct{}
+	done chan struct{}
+}
+
+// lockEntry takes the lock of the persistent clone at dir, waiting while
+// another process holds it
+func lockEntry(ctx context.Context, dir, name string) (*entryLock, error) {
+	waiting := false
+	for {
+		lock, err := tryLockEntry(dir)
+		if !errors.Is(err, errLocked) {
+			return lock, err
+		}
+		if !waiting {
+			fmt.Printf("⏳ Waiting for another dotme process using the %s\n", name)
+			waiting = true
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// tryLockEntry takes the lock of the persistent clone at dir without
+// waiting, returning errLocked when another process holds it
+func tryLockEntry(dir string) (*entryLock, error) {
+	path := dir + lockSuffix
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory for lock file %s: %w", path, err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if errors.Is(err, fs.ErrExist) {
+		info, statErr := os.Stat(path)
+		if statErr != nil || time.Since(info.ModTime()) < lockStaleAfter {
+			return nil, errLocked
+		}
+		// The process holding the lock died without releasing it
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to remove stale lock file %s: %w", path, err)
+		}
+		file, err = os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if errors.Is(err, fs.ErrExist) {
+			return nil, errLocked
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create lock file %s: %w", path, err)
+	}
+	fmt.Fprintf(file, "%d\n", os.Getpid())
+	if err := file.Close(); err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to write lock file %s: %w", path, err)
+	}
+
+	lock := &entryLock{path: path, stop: make(chan struct{}), done: make(chan struct{})}
+	go lock.refresh()
+	return lock, nil
+}
+
+// refresh keeps the lock file recent until the lock is released
+func (l *entryLock) refresh() {
+	defer close(l.done)
+	ticker := time.NewTicker(lockRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			now := time.Now()
+			_ = os.Chtimes(l.path, now, now)
+		}
+	}
+}
+
+// unlock releases the lock
+func (l *entryLock) unlock() {
+	close(l.stop)
+	<-l.done
+	os.Remove(l.path)
+}
@@ -0,0 +1,128 @@
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// netrcEntry holds the credentials of a machine in a netrc file
+type netrcEntry struct {
+	machine  string // Empty for the default entry
+	login    string
+	password string
+}
+
+// netrcPath returns the location of the netrc file
+func netrcPath() (string, error) {
+	if path := os.Getenv("NETRC"); path != "" {
+		return path, nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	name := ".netrc"
+	if runtime.GOOS == "windows" {
+		name = "_netrc"
+	}
+	return filepath.Join(homeDir, name), nil
+}
+
+// netrcCredentials looks up the login and password for host in the netrc
+// file, falling back to its default entry when no machine matches
+func netrcCredentials(host string) (string, string, bool, error) {
+	path, err := netrcPath()
+	if err != nil {
+		return "", "", false, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", "", false, nil
+	}
+	if err != nil {
+		return "", "", false, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var fallback *netrcEntry
+	for _, entry := range parseNetrc(string(data)) {
+		entry := entry
+		if entry.machine == "" {
+			fallback = &entry
+			continue
+		}
+		if strings.EqualFold(entry.machine, host) && entry.password != "" {
+			return entry.login, entry.password, true, nil
+		}
+	}
+
+	if fallback != nil && fallback.password != "" {
+		return fallback.login, fallback.password, true, nil
+	}
+	return "", "", false, nil
+}
+
+// parseNetrc parses the machine and default entries of a netrc file
+func parseNetrc(data string) []netrcEntry {
+	// Collect tokens, skipping macro definitions which end at a blank line
+	var tokens []string
+	inMacro := false
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if inMacro {
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+		fields := strings.Fields(line)
+		for i, field := range fields {
+			if strings.HasPrefix(field, "#") {
+				break
+			}
+			if field == "macdef" {
+				inMacro = true
+				break
+			}
+			tokens = append(tokens, fields[i])
+		}
+	}
+
+	var entries []netrcEntry
+	var current *netrcEntry
+	for i := 0; i < len(tokens); i++ {
+		next := func() string {
+			if i+1 < len(tokens) {
+				i++
+				return tokens[i]
+			}
+			return ""
+		}
+
+		switch tokens[i] {
+		case "machine":
+			entries = append(entries, netrcEntry{machine: next()})
+			current = &entries[len(entries)-1]
+		case "default":
+			entries = append(entries, netrcEntry{})
+			current = &entries[len(entries)-1]
+		case "login":
+			if value := next(); current != nil {
+				current.login = value
+			}
+		case "password":
+			if value := next(); current != nil {
+				current.password = value
+			}
+		case "account":
+			next()
+		}
+	}
+
+	return entries
+}
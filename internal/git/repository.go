@@ -1,36 +1,447 @@
 package git
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net"
 	"os"
+	"path/filepath"
+	"syscall"
+	"time"
 
 	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
 )
 
-// CloneRepository clones a Git repository to a local temporary directory
-func CloneRepository(repoURL string) (string, error) {
+// errFullCloneRequired is returned when a cached shallow clone cannot provide
+// the requested revision and has to be replaced by a full clone
+var errFullCloneRequired = errors.New("full clone required")
+
+// remoteError wraps failures to communicate with the remote repository
+type remoteError struct {
+	err error
+}
+
+func (e *remoteError) Error() string { return e.err.Error() }
+func (e *remoteError) Unwrap() error { return e.err }
+
+// CloneOptions contains the options used when cloning a repository
+type CloneOptions struct {
+	Ref          string // Branch, tag or commit to check out; empty uses the remote HEAD
+	FullClone    bool   // Clone the full history instead of a shallow single-branch clone
+	Cache        bool   // Reuse and update a persistent clone from the cache directory
+	Dir          string // Reuse and update a persistent checkout in this directory instead
+	Offline      bool   // Use the cached clone without contacting the remote
+	SSHKey       string // Private key file used for SSH remotes instead of the agent or default keys
+	NoSubmodules bool   // Skip initializing and checking out submodules
+	Verbose      bool   // Print details such as the authentication method
+}
+
+// Repository describes a cloned repository and the revision checked out in it
+type Repository struct {
+	Dir    string // Directory containing the working tree
+	Ref    string // Ref that was requested, empty for the remote HEAD
+	Commit string // Hash of the checked out commit
+
+	Local     bool      // Whether Dir is a local working tree used in place
+	Offline   bool      // Whether the cached clone was used without fetching
+	FetchedAt time.Time // Time the cached clone was last fetched
+
+	temporary bool   // Whether Dir is removed by Close
+	remoteURL string // URL Git LFS objects are fetched from, empty if unknown
+}
+
+// ShortCommit returns the abbreviated hash of the checked out commit
+func (r *Repository) ShortCommit() string {
+	if len(r.Commit) > 7 {
+		return r.Commit[:7]
+	}
+	return r.Commit
+}
+
+// Close releases the working tree. Temporary clones are removed while
+// cached clones are kept for later runs.
+func (r *Repository) Close() error {
+	if !r.temporary {
+		return nil
+	}
+	return os.RemoveAll(r.Dir)
+}
+
+// CloneRepository clones a Git repository and checks out the requested ref.
+// The clone is made in a temporary directory, in the persistent cache when
+// caching is enabled, or in the persistent checkout given by Dir.
+func CloneRepository(ctx context.Context, repoURL string, options *CloneOptions) (*Repository, error) {
+	if options == nil {
+		options = &CloneOptions{}
+	}
+
+	if options.Offline && !options.Cache && options.Dir == "" {
+		return nil, fmt.Errorf("offline mode requires the repository cache")
+	}
+
+	var auth transport.AuthMethod
+	if !options.Offline {
+		var method string
+		var err error
+		auth, method, err = resolveAuth(ctx, repoURL, options)
+		if err != nil {
+			return nil, err
+		}
+		if options.Verbose {
+			fmt.Printf("🔐 Authentication: %s\n", method)
+		}
+	}
+
+	if options.Dir != "" {
+		return cloneCheckout(ctx, options.Dir, repoURL, options, auth)
+	}
+	if options.Cache {
+		return cloneCached(ctx, repoURL, options, auth)
+	}
+
 	// Create a temporary directory
 	tempDir, err := os.MkdirTemp("", "dotme-*")
 	if err != nil {
-		return "", fmt.Errorf("failed to create temporary directory: %w", err)
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
 	}
 
 	fmt.Printf("🔄 Cloning repository: %s\n", repoURL)
 
 	// Clone the repository
-	r, err := git.PlainClone(tempDir, false, &git.CloneOptions{
-		URL: repoURL,
-	})
+	r, err := clone(ctx, tempDir, repoURL, options, auth)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		return nil, fmt.Errorf("failed to clone repository: %w", err)
+	}
+
+	hash, err := clonedRevision(r, options.Ref)
 	if err != nil {
 		os.RemoveAll(tempDir)
-		return "", fmt.Errorf("failed to clone repository: %w", err)
+		return nil, err
+	}
+	if err := checkout(r, hash); err != nil {
+		os.RemoveAll(tempDir)
+		return nil, err
+	}
+	if err := updateSubmodules(ctx, r, options, auth, false); err != nil {
+		os.RemoveAll(tempDir)
+		return nil, err
+	}
+
+	return &Repository{
+		Dir:       tempDir,
+		Ref:       options.Ref,
+		Commit:    hash.String(),
+		temporary: true,
+		remoteURL: repoURL,
+	}, nil
+}
+
+// clone clones the repository into dir. Unless a full clone is requested, only
+// the requested branch or tag is fetched with a depth of one; refs that cannot
+// be reached that way (such as commit hashes) fall back to a full clone.
+func clone(ctx context.Context, dir, repoURL string, options *CloneOptions, auth transport.AuthMethod) (*git.Repository, error) {
+	if !options.FullClone {
+		var refName plumbing.ReferenceName
+		if options.Ref != "" {
+			var err error
+			refName, err = lookupRemoteRef(ctx, repoURL, options.Ref, auth)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if options.Ref == "" || refName != "" {
+			r, err := git.PlainCloneContext(ctx, dir, false, &git.CloneOptions{
+				URL:           repoURL,
+				Auth:          auth,
+				ReferenceName: refName,
+				SingleBranch:  true,
+				Depth:         1,
+				Tags:          git.NoTags,
+			})
+			if err == nil {
+				return r, nil
+			}
+			if isTransportError(err) || ctx.Err() != nil {
+				return nil, err
+			}
+
+			fmt.Printf("⚠️  Shallow clone failed (%s), cloning full history\n", err)
+			if err := clearDir(dir); err != nil {
+				return nil, err
+			}
+		} else {
+			fmt.Printf("ℹ️  Ref %q is not a branch or tag, cloning full history\n", options.Ref)
+		}
+	}
+
+	return git.PlainCloneContext(ctx, dir, false, &git.CloneOptions{
+		URL:  repoURL,
+		Auth: auth,
+		Tags: git.AllTags,
+	})
+}
+
+// update fetches the requested ref into an existing clone and returns the
+// commit to check out along with the remote branch or tag it was fetched from,
+// which is empty for commits. errFullCloneRequired is returned when the clone
+// is shallow and the ref cannot be fetched shallowly.
+func update(ctx context.Context, r *git.Repository, repoURL string, options *CloneOptions, auth transport.AuthMethod) (plumbing.Hash, plumbing.ReferenceName, error) {
+	shallow, err := isShallow(r)
+	if err != nil {
+		return plumbing.ZeroHash, "", err
+	}
+	if shallow && options.FullClone {
+		return plumbing.ZeroHash, "", errFullCloneRequired
+	}
+
+	refName, err := lookupRemoteRef(ctx, repoURL, options.Ref, auth)
+	if err != nil {
+		return plumbing.ZeroHash, "", err
+	}
+
+	if refName == "" {
+		// The ref is not a branch or tag, so it can only be a commit that is
+		// either already cached or reachable through the full history
+		if hash, err := resolveRef(r, options.Ref); err == nil {
+			return hash, "", nil
+		}
+		if shallow {
+			return plumbing.ZeroHash, "", errFullCloneRequired
+		}
+		if err := fetch(ctx, r, auth, 0,
+			config.RefSpec("+refs/heads/*:refs/remotes/origin/*"),
+			config.RefSpec("+refs/tags/*:refs/tags/*"),
+		); err != nil {
+			return plumbing.ZeroHash, "", err
+		}
+		hash, err := resolveRef(r, options.Ref)
+		return hash, "", err
+	}
+
+	localName := plumbing.NewRemoteReferenceName(git.DefaultRemoteName, refName.Short())
+	if refName.IsTag() {
+		localName = refName
+	}
+
+	depth := 0
+	if shallow {
+		depth = 1
+	}
+	if err := fetch(ctx, r, auth, depth, config.RefSpec(fmt.Sprintf("+%s:%s", refName, localName))); err != nil {
+		return plumbing.ZeroHash, "", err
+	}
+
+	hash, err := r.ResolveRevision(plumbing.Revision(localName))
+	if err != nil {
+		return plumbing.ZeroHash, "", fmt.Errorf("failed to resolve %s: %w", localName, err)
+	}
+	return *hash, refName, nil
+}
+
+// fetch fetches the given refspecs from the origin remote
+func fetch(ctx context.Context, r *git.Repository, auth transport.AuthMethod, depth int, refSpecs ...config.RefSpec) error {
+	err := r.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: git.DefaultRemoteName,
+		RefSpecs:   refSpecs,
+		Auth:       auth,
+		Depth:      depth,
+		Tags:       git.NoTags,
+		Force:      true,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return &remoteError{fmt.Errorf("failed to fetch repository: %w", err)}
+	}
+	return nil
+}
+
+// lookupRemoteRef looks up ref among the branches and tags of the remote
+// repository and returns its full reference name. An empty ref resolves to
+// the branch the remote HEAD points to, and an empty name is returned when
+// the ref is not a branch or tag.
+func lookupRemoteRef(ctx context.Context, repoURL, ref string, auth transport.AuthMethod) (plumbing.ReferenceName, error) {
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{repoURL},
+	})
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil {
+		return "", &remoteError{fmt.Errorf("failed to list remote refs: %w", err)}
+	}
+
+	if ref == "" {
+		for _, remoteRef := range refs {
+			if remoteRef.Name() == plumbing.HEAD && remoteRef.Type() == plumbing.SymbolicReference {
+				return remoteRef.Target(), nil
+			}
+		}
+		return "", fmt.Errorf("failed to determine the remote default branch")
+	}
+
+	candidates := []plumbing.ReferenceName{
+		plumbing.ReferenceName(ref),
+		plumbing.NewBranchReferenceName(ref),
+		plumbing.NewTagReferenceName(ref),
+	}
+	for _, candidate := range candidates {
+		for _, remoteRef := range refs {
+			if remoteRef.Name() == candidate && (candidate.IsBranch() || candidate.IsTag()) {
+				return candidate, nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// isTransportError reports whether err is caused by the remote being
+// unreachable or inaccessible, in which case retrying with a full clone is pointless
+func isTransportError(err error) bool {
+	return errors.Is(err, transport.ErrRepositoryNotFound) ||
+		errors.Is(err, transport.ErrAuthenticationRequired) ||
+		errors.Is(err, transport.ErrAuthorizationFailed) ||
+		errors.Is(err, transport.ErrEmptyRemoteRepository)
+}
+
+// isNetworkError reports whether err is caused by the remote being
+// unreachable, such as a failed DNS lookup, a refused connection or a
+// timeout, rather than by the remote refusing the request
+func isNetworkError(err error) bool {
+	// go-git wraps some transport failures without unwrapping support
+	var unexpected *plumbing.UnexpectedError
+	if errors.As(err, &unexpected) {
+		return isNetworkError(unexpected.Err)
+	}
+
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	return errors.As(err, &opErr) ||
+		errors.As(err, &dnsErr) ||
+		(errors.As(err, &netErr) && netErr.Timeout()) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET)
+}
+
+// isShallow reports whether the repository is a shallow clone
+func isShallow(r *git.Repository) (bool, error) {
+	shallows, err := r.Storer.Shallow()
+	if err != nil {
+		return false, fmt.Errorf("failed to read shallow commits: %w", err)
+	}
+	return len(shallows) > 0, nil
+}
+
+// clearDir removes all entries of a directory, leaving the directory itself in place
+func clearDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read directory %s: %w", dir, err)
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", entry.Name(), err)
+		}
+	}
+	return nil
+}
+
+// clonedRevision returns the commit to check out in a fresh clone
+func clonedRevision(r *git.Repository, ref string) (plumbing.Hash, error) {
+	if ref != "" {
+		hash, err := resolveRef(r, ref)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		fmt.Printf("✅ Repository cloned, using ref: %s\n", ref)
+		return hash, nil
 	}
 
 	// Get repository information for detailed output
-	ref, err := r.Head()
-	if err == nil {
-		fmt.Printf("✅ Repository cloned, using branch: %s\n", ref.Name().Short())
+	head, err := r.Head()
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to get repository HEAD: %w", err)
+	}
+	fmt.Printf("✅ Repository cloned, using branch: %s\n", head.Name().Short())
+	return head.Hash(), nil
+}
+
+// checkout checks out a commit, discarding any local changes and untracked files
+func checkout(r *git.Repository, hash plumbing.Hash) error {
+	worktree, err := r.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to open worktree: %w", err)
+	}
+
+	if err := worktree.Checkout(&git.CheckoutOptions{Hash: hash, Force: true}); err != nil {
+		return fmt.Errorf("failed to check out commit %s: %w", hash, err)
+	}
+	if err := worktree.Clean(&git.CleanOptions{Dir: true}); err != nil {
+		return fmt.Errorf("failed to clean worktree: %w", err)
+	}
+
+	return nil
+}
+
+// resolveRef resolves a ref to a commit hash. Remote-tracking branches are
+// tried first since they are kept up to date by fetches, while local branches
+// only exist for the branch a repository was originally cloned with.
+func resolveRef(r *git.Repository, ref string) (plumbing.Hash, error) {
+	candidates := []string{"refs/remotes/origin/" + ref, ref}
+	for _, candidate := range candidates {
+		hash, err := r.ResolveRevision(plumbing.Revision(candidate))
+		if err == nil {
+			return *hash, nil
+		}
+	}
+	return plumbing.ZeroHash, fmt.Errorf("failed to resolve ref %q: no matching branch, tag or commit", ref)
+}
+
+// OpenRepository opens a local git working tree in place. The working tree is
+// used as-is, including uncommitted changes, and is left untouched by Close.
+func OpenRepository(dir string) (*Repository, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open repository %s: %w", dir, err)
 	}
 
-	return tempDir, nil
+	head, err := r.Head()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get repository HEAD: %w", err)
+	}
+
+	// Git LFS objects missing from the working tree are fetched from origin
+	var remoteURL string
+	if remote, err := r.Remote(git.DefaultRemoteName); err == nil && len(remote.Config().URLs) > 0 {
+		remoteURL = remote.Config().URLs[0]
+	}
+
+	return &Repository{
+		Dir:       dir,
+		Commit:    head.Hash().String(),
+		Local:     true,
+		remoteURL: remoteURL,
+	}, nil
+}
+
+// IsRepository reports whether dir is the root of a git working tree
+func IsRepository(dir string) bool {
+	_, err := git.PlainOpen(dir)
+	return err == nil
+}
+
+// GlobalUserEmail returns user.email from the global git configuration, or an
+// empty string when it is not set
+func GlobalUserEmail() string {
+	cfg, err := config.LoadConfig(config.GlobalScope)
+	if err != nil {
+		return ""
+	}
+	return cfg.User.Email
 }
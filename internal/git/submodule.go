@@ -0,0 +1,80 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// updateSubmodules initializes and checks out the submodules of the working
+// tree recursively. Submodules with relative URLs are fetched with the
+// credentials of their parent repository; other URLs get their own, at every
+// level of nesting. In offline mode only objects already present in the cache
+// are used.
+func updateSubmodules(ctx context.Context, r *git.Repository, options *CloneOptions, auth transport.AuthMethod, offline bool) error {
+	if options.NoSubmodules {
+		return nil
+	}
+	return updateNestedSubmodules(ctx, r, "", options, auth, offline, git.DefaultSubmoduleRecursionDepth)
+}
+
+// updateNestedSubmodules updates the submodules of r, whose working tree is at
+// prefix in the top-level one, and then theirs, up to depth levels deep
+func updateNestedSubmodules(ctx context.Context, r *git.Repository, prefix string, options *CloneOptions, auth transport.AuthMethod, offline bool, depth git.SubmoduleRescursivity) error {
+	if depth == 0 {
+		return nil
+	}
+
+	worktree, err := r.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to open worktree: %w", err)
+	}
+
+	submodules, err := worktree.Submodules()
+	if err != nil {
+		return fmt.Errorf("failed to read submodules: %w", err)
+	}
+
+	for _, submodule := range submodules {
+		config := submodule.Config()
+		fullPath := path.Join(prefix, config.Path)
+
+		submoduleAuth := auth
+		if !offline && !isRelativeURL(config.URL) {
+			submoduleAuth, _, err = resolveAuth(ctx, config.URL, options)
+			if err != nil {
+				return err
+			}
+		}
+
+		err := submodule.UpdateContext(ctx, &git.SubmoduleUpdateOptions{
+			Init:    true,
+			NoFetch: offline,
+			Auth:    submoduleAuth,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update submodule %s: %w", fullPath, err)
+		}
+
+		fmt.Printf("📦 Submodule updated: %s\n", fullPath)
+
+		repo, err := submodule.Repository()
+		if err != nil {
+			return fmt.Errorf("failed to open submodule %s: %w", fullPath, err)
+		}
+		if err := updateNestedSubmodules(ctx, repo, fullPath, options, submoduleAuth, offline, depth-1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isRelativeURL reports whether a submodule URL is relative to the URL of the parent repository
+func isRelativeURL(url string) bool {
+	return strings.HasPrefix(url, "./") || strings.HasPrefix(url, "../")
+}
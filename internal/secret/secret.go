@@ -0,0 +1,238 @@
+package secret
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/rsvinicius/dotme/internal/alias"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+)
+
+// Suffix marks encrypted dotfiles. It is stripped from the destination name.
+const Suffix = ".enc"
+
+// blockType is the PEM type of encrypted files
+const blockType = "DOTME ENCRYPTED FILE"
+
+// scrypt parameters used for new files; decryption reads them from the file
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+	keySize = 32
+)
+
+// Bounds of the scrypt parameters accepted when decrypting, so that a crafted
+// header cannot make key derivation take unbounded time or memory
+const (
+	maxScryptN      = 1 << 20
+	maxScryptR      = 32
+	maxScryptP      = 16
+	maxScryptMemory = 1 << 30 // Bytes, scrypt uses 128*N*r
+)
+
+// ErrWrongSecret is returned when a file cannot be decrypted with the given secret
+var ErrWrongSecret = errors.New("wrong passphrase or key file, or the file was modified")
+
+// Encrypt encrypts plaintext with AES-256-GCM under a key derived from secret
+// with scrypt, returning a PEM armored file that is safe to commit
+func Encrypt(plaintext, secret []byte) ([]byte, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	gcm, err := newGCM(secret, salt, scryptN, scryptR, scryptP)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	block := &pem.Block{
+		Type: blockType,
+		Headers: map[string]string{
+			"Cipher": "AES-256-GCM",
+			"KDF":    fmt.Sprintf("scrypt N=%d r=%d p=%d", scryptN, scryptR, scryptP),
+			"Salt":   base64.StdEncoding.EncodeToString(salt),
+		},
+		Bytes: gcm.Seal(nonce, nonce, plaintext, nil),
+	}
+	return pem.EncodeToMemory(block), nil
+}
+
+// Decrypt decrypts a file produced by Encrypt with secret
+func Decrypt(data, secret []byte) ([]byte, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != blockType {
+		return nil, errors.New("not a dotme encrypted file")
+	}
+	if cipherName := block.Headers["Cipher"]; cipherName != "AES-256-GCM" {
+		return nil, fmt.Errorf("unsupported cipher %q", cipherName)
+	}
+
+	var n, r, p int
+	_, err := fmt.Sscanf(block.Headers["KDF"], "scrypt N=%d r=%d p=%d", &n, &r, &p)
+	if err != nil || !validScrypt(n, r, p) {
+		return nil, fmt.Errorf("unsupported key derivation %q", block.Headers["KDF"])
+	}
+	salt, err := base64.StdEncoding.DecodeString(block.Headers["Salt"])
+	if err != nil || len(salt) == 0 {
+		return nil, errors.New("invalid salt")
+	}
+
+	gcm, err := newGCM(secret, salt, n, r, p)
+	if err != nil {
+		return nil, err
+	}
+	if len(block.Bytes) < gcm.NonceSize() {
+		return nil, ErrWrongSecret
+	}
+	nonce, ciphertext := block.Bytes[:gcm.NonceSize()], block.Bytes[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrWrongSecret
+	}
+	return plaintext, nil
+}
+
+// validScrypt reports whether the scrypt parameters of a file are within the
+// accepted bounds. N must be a power of two greater than one.
+func validScrypt(n, r, p int) bool {
+	switch {
+	case n <= 1 || n > maxScryptN || n&(n-1) != 0:
+		return false
+	case r < 1 || r > maxScryptR || p < 1 || p > maxScryptP:
+		return false
+	default:
+		return 128*n*r <= maxScryptMemory
+	}
+}
+
+// IsEncrypted reports whether data is a file produced by Encrypt
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("-----BEGIN "+blockType+"-----"))
+}
+
+// newGCM derives the file key from secret and returns its AES-GCM cipher
+func newGCM(secret, salt []byte, n, r, p int) (cipher.AEAD, error) {
+	key, err := scrypt.Key(secret, salt, n, r, p, keySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// DefaultKeyFile returns the key file used when no other secret is given
+func DefaultKeyFile() (string, error) {
+	configDir, err := alias.GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "key"), nil
+}
+
+// Load returns the secret to encrypt or decrypt with, taken from keyFile when
+// given, then DOTME_PASSPHRASE, then the default key file and finally a
+// terminal prompt. confirm asks for a prompted passphrase twice.
+func Load(keyFile string, confirm bool) ([]byte, error) {
+	if keyFile != "" {
+		return readKeyFile(keyFile)
+	}
+	if passphrase := os.Getenv("DOTME_PASSPHRASE"); passphrase != "" {
+		return []byte(passphrase), nil
+	}
+	if defaultKeyFile, err := DefaultKeyFile(); err == nil {
+		if _, err := os.Stat(defaultKeyFile); err == nil {
+			return readKeyFile(defaultKeyFile)
+		}
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, errors.New("no secret available; use --key-file, set DOTME_PASSPHRASE or run dotme in a terminal")
+	}
+
+	passphrase, err := prompt(fd, "🔑 Enter passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if len(passphrase) == 0 {
+		return nil, errors.New("the passphrase cannot be empty")
+	}
+	if confirm {
+		again, err := prompt(fd, "🔑 Repeat passphrase: ")
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(passphrase, again) {
+			return nil, errors.New("the passphrases do not match")
+		}
+	}
+	return passphrase, nil
+}
+
+// NewDecrypter returns a function decrypting files with the secret from Load,
+// which is only loaded when the first file is decrypted
+func NewDecrypter(keyFile string) func(data []byte) ([]byte, error) {
+	var secret []byte
+	return func(data []byte) ([]byte, error) {
+		if secret == nil {
+			loaded, err := Load(keyFile, false)
+			if err != nil {
+				return nil, err
+			}
+			secret = loaded
+		}
+		return Decrypt(data, secret)
+	}
+}
+
+// readKeyFile reads a key file, which must not be readable by other users
+func readKeyFile(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	// Windows does not report Unix permission bits, so they cannot be checked there
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("key file %s is accessible by other users, run chmod 600 %s", path, path)
+	}
+
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	key = bytes.TrimSpace(key)
+	if len(key) == 0 {
+		return nil, fmt.Errorf("key file %s is empty", path)
+	}
+	return key, nil
+}
+
+// prompt reads a passphrase from the terminal without echoing it
+func prompt(fd int, message string) ([]byte, error) {
+	fmt.Fprint(os.Stderr, message)
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return passphrase, nil
+}
@@ -0,0 +1,369 @@
+package source
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Limits protecting against oversized archives and decompression bombs
+const (
+	maxArchiveSize      = 512 << 20 // Maximum size of a downloaded archive in bytes
+	maxExtractedSize    = 1 << 30   // Maximum total size of extracted files in bytes
+	maxArchiveEntries   = 100000    // Maximum number of entries in an archive
+	maxCompressionRatio = 200       // Maximum uncompressed to compressed size ratio of a zip entry
+)
+
+// archiveExtensions lists the supported archive extensions
+var archiveExtensions = []string{".tar.gz", ".tgz", ".zip"}
+
+// ErrArchiveTooLarge is returned when an archive exceeds the extraction limits
+var ErrArchiveTooLarge = errors.New("archive exceeds the size limits")
+
+// archiveSource is a .tar.gz, .tgz or .zip archive, given as a local path or HTTP(S) URL
+type archiveSource struct {
+	location string
+}
+
+// isArchive reports whether a location refers to a supported archive
+func isArchive(location string) bool {
+	name := location
+	if u, err := url.Parse(location); err == nil && u.Scheme != "" && u.Host != "" {
+		name = u.Path
+	}
+
+	name = strings.ToLower(name)
+	for _, ext := range archiveExtensions {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// isRemote reports whether the archive has to be downloaded
+func (s *archiveSource) isRemote() bool {
+	return strings.HasPrefix(s.location, "http://") || strings.HasPrefix(s.location, "https://")
+}
+
+// Open downloads the archive if needed and extracts it into a temporary directory
+func (s *archiveSource) Open(ctx context.Context, options *Options) (*Snapshot, error) {
+	if options.Ref != "" {
+		return nil, fmt.Errorf("--ref is not supported for archive sources")
+	}
+	if options.CheckoutDir != "" {
+		return nil, fmt.Errorf("--link is not supported for archive sources, which are extracted into a temporary directory")
+	}
+
+	tempDir, err := os.MkdirTemp("", "dotme-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+
+	snapshot, err := s.extract(ctx, tempDir)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// extract makes the archive contents available below tempDir
+func (s *archiveSource) extract(ctx context.Context, tempDir string) (*Snapshot, error) {
+	archivePath, _, err := localPath(s.location)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.isRemote() {
+		fmt.Printf("🔄 Downloading archive: %s\n", s.location)
+		archivePath = filepath.Join(tempDir, "archive")
+		if err := download(ctx, s.location, archivePath); err != nil {
+			return nil, err
+		}
+	} else {
+		fmt.Printf("📦 Using archive: %s\n", archivePath)
+	}
+
+	checksum, err := fileChecksum(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	contentsDir := filepath.Join(tempDir, "contents")
+	if err := os.Mkdir(contentsDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create extraction directory: %w", err)
+	}
+
+	if strings.HasSuffix(strings.ToLower(s.name()), ".zip") {
+		err = extractZip(ctx, archivePath, contentsDir)
+	} else {
+		err = extractTarGz(ctx, archivePath, contentsDir)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := contentRoot(contentsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Snapshot{
+		Dir:      root,
+		Revision: fmt.Sprintf("archive %s (sha256 %s)", s.name(), checksum[:12]),
+		release: func() error {
+			return os.RemoveAll(tempDir)
+		},
+	}, nil
+}
+
+// name returns the file name of the archive
+func (s *archiveSource) name() string {
+	if u, err := url.Parse(s.location); err == nil && u.Scheme != "" && u.Host != "" {
+		return path.Base(u.Path)
+	}
+	return filepath.Base(s.location)
+}
+
+// download fetches an archive over HTTP(S) into dest
+func download(ctx context.Context, archiveURL, dest string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, archiveURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create download request: %w", err)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download archive: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download archive: %s", resp.Status)
+	}
+	if resp.ContentLength > maxArchiveSize {
+		return fmt.Errorf("%w: download is %d bytes", ErrArchiveTooLarge, resp.ContentLength)
+	}
+
+	file, err := os.Create(dest)
+	if err != nil {
+		return fmt.Errorf("failed to create archive file: %w", err)
+	}
+	defer file.Close()
+
+	n, err := io.Copy(file, io.LimitReader(resp.Body, maxArchiveSize+1))
+	if err != nil {
+		return fmt.Errorf("failed to download archive: %w", err)
+	}
+	if n > maxArchiveSize {
+		return fmt.Errorf("%w: download exceeds %d bytes", ErrArchiveTooLarge, int64(maxArchiveSize))
+	}
+
+	return nil
+}
+
+// fileChecksum returns the hex-encoded SHA-256 checksum of a file
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to read archive: %w", err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// extractor writes archive entries below a directory while enforcing the
+// entry count and extracted size limits. Extraction stops once ctx is done.
+type extractor struct {
+	ctx       context.Context
+	dir       string
+	entries   int
+	extracted int64
+}
+
+// target returns the destination path of an archive entry, rejecting names
+// that would escape the extraction directory. An empty path is returned for
+// the archive root.
+func (e *extractor) target(name string) (string, error) {
+	if err := e.ctx.Err(); err != nil {
+		return "", err
+	}
+
+	e.entries++
+	if e.entries > maxArchiveEntries {
+		return "", fmt.Errorf("%w: more than %d entries", ErrArchiveTooLarge, maxArchiveEntries)
+	}
+
+	cleaned := filepath.Clean(filepath.FromSlash(name))
+	if cleaned == "." {
+		return "", nil
+	}
+	if !filepath.IsLocal(cleaned) {
+		return "", fmt.Errorf("archive entry %q escapes the extraction directory", name)
+	}
+
+	return filepath.Join(e.dir, cleaned), nil
+}
+
+// writeFile extracts a regular file, counting its size against the limit
+func (e *extractor) writeFile(target string, r io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", target, err)
+	}
+
+	file, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm()|0200)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", target, err)
+	}
+	defer file.Close()
+
+	remaining := maxExtractedSize - e.extracted
+	n, err := io.Copy(file, io.LimitReader(r, remaining+1))
+	e.extracted += n
+	if err != nil {
+		return fmt.Errorf("failed to extract %s: %w", target, err)
+	}
+	if n > remaining {
+		return fmt.Errorf("%w: contents exceed %d bytes", ErrArchiveTooLarge, int64(maxExtractedSize))
+	}
+
+	return nil
+}
+
+// extractTarGz extracts a gzip-compressed tar archive into dir
+func extractTarGz(ctx context.Context, archivePath, dir string) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("failed to read gzip archive: %w", err)
+	}
+	defer gz.Close()
+
+	e := &extractor{ctx: ctx, dir: dir}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar archive: %w", err)
+		}
+
+		target, err := e.target(header.Name)
+		if err != nil {
+			return err
+		}
+		if target == "" {
+			continue
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return fmt.Errorf("failed to create directory %s: %w", target, err)
+			}
+		case tar.TypeReg:
+			if err := e.writeFile(target, tr, header.FileInfo().Mode()); err != nil {
+				return err
+			}
+		default:
+			// Links and special files could point outside the extraction directory
+			fmt.Printf("⚠️  Skipping unsupported archive entry: %s\n", header.Name)
+		}
+	}
+
+	return nil
+}
+
+// extractZip extracts a zip archive into dir
+func extractZip(ctx context.Context, archivePath, dir string) error {
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to read zip archive: %w", err)
+	}
+	defer reader.Close()
+
+	e := &extractor{ctx: ctx, dir: dir}
+	for _, f := range reader.File {
+		target, err := e.target(f.Name)
+		if err != nil {
+			return err
+		}
+		if target == "" {
+			continue
+		}
+
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return fmt.Errorf("failed to create directory %s: %w", target, err)
+			}
+		case mode.IsRegular():
+			if f.CompressedSize64 > 0 && f.UncompressedSize64/f.CompressedSize64 > maxCompressionRatio {
+				return fmt.Errorf("%w: entry %s has a suspicious compression ratio", ErrArchiveTooLarge, f.Name)
+			}
+			if err := extractZipFile(e, f, target); err != nil {
+				return err
+			}
+		default:
+			fmt.Printf("⚠️  Skipping unsupported archive entry: %s\n", f.Name)
+		}
+	}
+
+	return nil
+}
+
+// extractZipFile extracts a single regular file from a zip archive
+func extractZipFile(e *extractor, f *zip.File, target string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open archive entry %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+
+	return e.writeFile(target, rc, f.Mode())
+}
+
+// contentRoot returns the directory to scan for dotfiles. Archives that wrap
+// their contents in a single top-level directory (as release archives usually
+// do) are scanned inside that directory, unless it is itself a dotfile.
+func contentRoot(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read extracted archive: %w", err)
+	}
+
+	if len(entries) == 1 && entries[0].IsDir() && !strings.HasPrefix(entries[0].Name(), ".") {
+		return filepath.Join(dir, entries[0].Name()), nil
+	}
+	return dir, nil
+}
@@ -0,0 +1,58 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rsvinicius/dotme/internal/git"
+)
+
+// gitSource is a remote git repository
+type gitSource struct {
+	url string
+}
+
+// Open clones the repository into the checkout directory, the cache or a temporary directory
+func (s *gitSource) Open(ctx context.Context, options *Options) (*Snapshot, error) {
+	repo, err := git.CloneRepository(ctx, s.url, &git.CloneOptions{
+		Ref:          options.Ref,
+		FullClone:    options.FullClone,
+		Cache:        !options.NoCache,
+		Dir:          options.CheckoutDir,
+		Offline:      options.Offline,
+		SSHKey:       options.SSHKey,
+		NoSubmodules: options.NoSubmodules,
+		Verbose:      options.Verbose,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return repositorySnapshot(repo), nil
+}
+
+// repositorySnapshot wraps an opened git repository in a snapshot
+func repositorySnapshot(repo *git.Repository) *Snapshot {
+	return &Snapshot{
+		Dir:      repo.Dir,
+		Revision: describeRevision(repo),
+		LFS:      repo.FetchLFSObject,
+		release:  repo.Close,
+	}
+}
+
+// describeRevision returns a human-readable description of the checked out revision
+func describeRevision(repo *git.Repository) string {
+	revision := repo.ShortCommit()
+	if repo.Local {
+		revision = fmt.Sprintf("working tree at %s", repo.ShortCommit())
+	}
+	if repo.Ref != "" {
+		revision = fmt.Sprintf("%s (%s)", repo.Ref, repo.ShortCommit())
+	}
+	if repo.Offline {
+		revision += fmt.Sprintf(" from cached copy fetched at %s", repo.FetchedAt.Format(time.RFC822))
+	}
+	return revision
+}
@@ -0,0 +1,100 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/rsvinicius/dotme/internal/git"
+)
+
+// localSource is a local directory, either a git working tree or a plain directory
+type localSource struct {
+	dir string
+}
+
+// Open uses the directory in place. Working trees are used as-is, including
+// uncommitted changes, unless a ref is requested, in which case the committed
+// revision is cloned into a temporary directory or the checkout directory.
+func (s *localSource) Open(ctx context.Context, options *Options) (*Snapshot, error) {
+	if !git.IsRepository(s.dir) {
+		if options.Ref != "" {
+			return nil, fmt.Errorf("--ref requires a git repository, %s is a plain directory", s.dir)
+		}
+		fmt.Printf("📂 Using local directory: %s\n", s.dir)
+		return &Snapshot{Dir: s.dir, Revision: "local directory"}, nil
+	}
+
+	var repo *git.Repository
+	var err error
+	if options.Ref == "" {
+		fmt.Printf("📂 Using local working tree: %s\n", s.dir)
+		repo, err = git.OpenRepository(s.dir)
+	} else {
+		// Local repositories are cheap to clone and are never cached
+		repo, err = git.CloneRepository(ctx, s.dir, &git.CloneOptions{
+			Ref:          options.Ref,
+			FullClone:    options.FullClone,
+			Dir:          options.CheckoutDir,
+			NoSubmodules: options.NoSubmodules,
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return repositorySnapshot(repo), nil
+}
+
+// localDir returns the absolute directory referenced by a local path or
+// file:// URL. The second return value is false when location is not local.
+func localDir(location string) (string, bool, error) {
+	path, isFileURL, err := localPath(location)
+	if err != nil {
+		return "", false, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if isFileURL {
+			return "", false, fmt.Errorf("failed to access %s: %w", path, err)
+		}
+		return "", false, nil
+	}
+	if !info.IsDir() {
+		return "", false, fmt.Errorf("%s is not a directory or supported archive", path)
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to resolve path %s: %w", path, err)
+	}
+
+	return absPath, true, nil
+}
+
+// localPath converts a file:// URL to a filesystem path. Other locations are
+// returned unchanged, and the second return value reports whether location
+// was a file:// URL.
+func localPath(location string) (string, bool, error) {
+	if !strings.HasPrefix(location, "file://") {
+		return location, false, nil
+	}
+
+	u, err := url.Parse(location)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid file URL %s: %w", location, err)
+	}
+
+	path := u.Path
+	if runtime.GOOS == "windows" {
+		// file:///C:/dotfiles has the path /C:/dotfiles
+		path = strings.TrimPrefix(path, "/")
+	}
+
+	return filepath.FromSlash(path), true, nil
+}
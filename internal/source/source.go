@@ -0,0 +1,196 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rsvinicius/dotme/internal/fs"
+)
+
+// subdirSeparator separates a location from a subdirectory inside it
+const subdirSeparator = "//"
+
+// Options contains the settings used when opening a source
+type Options struct {
+	Ref          string // Branch, tag or commit to open; only supported by git sources
+	FullClone    bool   // Clone the full history instead of a shallow clone
+	NoCache      bool   // Clone into a temporary directory instead of the cache
+	Offline      bool   // Use the cached copy without contacting the remote
+	Path         string // Subdirectory of the source to scan for dotfiles
+	SSHKey       string // Private key file used for SSH remotes
+	NoSubmodules bool   // Skip initializing and checking out submodules of git sources
+	Verbose      bool   // Print details such as the authentication method
+	CheckoutDir  string // Persistent directory git repositories are checked out into, used for linking
+}
+
+// Source is a location dotfiles can be applied from
+type Source interface {
+	// Open makes the contents of the source available in a local directory
+	Open(ctx context.Context, options *Options) (*Snapshot, error)
+}
+
+// Snapshot is a local directory holding the contents of an opened source
+type Snapshot struct {
+	Dir      string        // Directory containing the dotfiles
+	Root     string        // Root of the source, which differs from Dir for subdirectories
+	Revision string        // Human-readable description of the opened revision
+	LFS      fs.LFSFetcher // Fetches Git LFS objects, nil if the source has no LFS endpoint
+
+	release func() error // Releases temporary files, if any
+}
+
+// Close releases the temporary files backing the snapshot
+func (s *Snapshot) Close() error {
+	if s.release == nil {
+		return nil
+	}
+	return s.release()
+}
+
+// Parse determines the kind of source a location refers to. Archives are
+// recognized by their extension, existing local directories and file:// URLs
+// are used in place and everything else is treated as a git repository URL.
+func Parse(location string) (Source, error) {
+	if isArchive(location) {
+		return &archiveSource{location: location}, nil
+	}
+
+	dir, isLocal, err := localDir(location)
+	if err != nil {
+		return nil, err
+	}
+	if isLocal {
+		return &localSource{dir: dir}, nil
+	}
+
+	return &gitSource{url: location}, nil
+}
+
+// SplitSubdir splits a location of the form <location>//<subdir> into the
+// location and the subdirectory. The separator is searched for after the
+// scheme, so https://example.com/dotfiles.git//go yields
+// "https://example.com/dotfiles.git" and "go". Query strings stay with the location.
+func SplitSubdir(location string) (string, string) {
+	start := 0
+	if i := strings.Index(location, "://"); i >= 0 {
+		start = i + len("://")
+	}
+
+	i := strings.Index(location[start:], subdirSeparator)
+	if i < 0 {
+		return location, ""
+	}
+
+	base := location[:start+i]
+	subdir := location[start+i+len(subdirSeparator):]
+	if q := strings.IndexByte(subdir, '?'); q >= 0 {
+		base += subdir[q:]
+		subdir = subdir[:q]
+	}
+
+	return base, strings.Trim(subdir, "/")
+}
+
+// JoinSubdir returns the location referring to subdir inside location, the
+// inverse of SplitSubdir
+func JoinSubdir(location, subdir string) (string, error) {
+	subdir = strings.Trim(filepath.ToSlash(subdir), "/")
+	if subdir == "" {
+		return location, nil
+	}
+
+	base, existing := SplitSubdir(location)
+	if existing != "" {
+		return "", fmt.Errorf("location %s already contains the subdirectory %s", location, existing)
+	}
+
+	query := ""
+	if q := strings.IndexByte(base, '?'); q >= 0 && strings.Contains(base, "://") {
+		base, query = base[:q], base[q:]
+	}
+
+	return base + subdirSeparator + subdir + query, nil
+}
+
+// Open parses a location and opens the source it refers to. A subdirectory
+// given with the <location>//<subdir> syntax or Options.Path becomes the
+// directory of the returned snapshot.
+func Open(ctx context.Context, location string, options *Options) (*Snapshot, error) {
+	if options == nil {
+		options = &Options{}
+	}
+
+	base, subdir := SplitSubdir(location)
+	if options.Path != "" {
+		path := strings.Trim(filepath.ToSlash(options.Path), "/")
+		if subdir != "" && subdir != path {
+			return nil, fmt.Errorf("subdirectory %s given in the location conflicts with --path %s", subdir, options.Path)
+		}
+		subdir = path
+	}
+
+	src, err := Parse(base)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot, err := src.Open(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot == nil {
+		return nil, fmt.Errorf("source %s returned no contents", location)
+	}
+	snapshot.Root = snapshot.Dir
+
+	if subdir != "" {
+		dir, err := subdirectory(snapshot.Dir, subdir)
+		if err != nil {
+			snapshot.Close()
+			return nil, err
+		}
+		snapshot.Dir = dir
+		snapshot.Revision += fmt.Sprintf(", path %s", subdir)
+	}
+
+	return snapshot, nil
+}
+
+// subdirectory returns the path of subdir inside root, rejecting paths that
+// escape root and paths that are not directories
+func subdirectory(root, subdir string) (string, error) {
+	cleaned := filepath.Clean(filepath.FromSlash(subdir))
+	if !filepath.IsLocal(cleaned) {
+		return "", fmt.Errorf("path %s must be a relative path inside the source", subdir)
+	}
+
+	dir := filepath.Join(root, cleaned)
+	info, err := os.Stat(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("path %s does not exist in the source", subdir)
+		}
+		return "", fmt.Errorf("failed to access path %s: %w", subdir, err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("path %s is not a directory", subdir)
+	}
+
+	// A symlinked subdirectory must not lead outside the source either
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", root, err)
+	}
+	resolvedDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve path %s: %w", subdir, err)
+	}
+	if rel, err := filepath.Rel(resolvedRoot, resolvedDir); err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("path %s must be a relative path inside the source", subdir)
+	}
+
+	return dir, nil
+}
@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"runtime"
+	"strings"
+
+	"github.com/rsvinicius/dotme/internal/alias"
+	"github.com/rsvinicius/dotme/internal/git"
+)
+
+// ParseVars parses --var flags of the form key=value
+func ParseVars(args []string) (map[string]string, error) {
+	vars := make(map[string]string, len(args))
+	for _, arg := range args {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid variable %q, expected key=value", arg)
+		}
+		if err := alias.ValidateVariableName(name); err != nil {
+			return nil, err
+		}
+		vars[name] = value
+	}
+	return vars, nil
+}
+
+// templateData returns the data .tmpl files are rendered with: facts about the
+// machine and the user, and the variables saved in the configuration, which
+// vars override, under Vars
+func templateData(vars map[string]string) map[string]any {
+	allVars := make(map[string]string)
+	if configVars, err := alias.GetVariables(); err == nil {
+		for name, value := range configVars {
+			allVars[name] = value
+		}
+	}
+	for name, value := range vars {
+		allVars[name] = value
+	}
+
+	hostname, _ := os.Hostname()
+	homeDir, _ := os.UserHomeDir()
+	var username string
+	if current, err := user.Current(); err == nil {
+		username = current.Username
+	}
+
+	return map[string]any{
+		"Hostname": hostname,
+		"OS":       runtime.GOOS,
+		"Arch":     runtime.GOARCH,
+		"Username": username,
+		"HomeDir":  homeDir,
+		"GitEmail": git.GlobalUserEmail(),
+		"Vars":     allVars,
+	}
+}
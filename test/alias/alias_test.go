@@ -321,4 +321,36 @@ func TestDefaultPatterns(t *testing.T) {
 			t.Errorf("Exclude pattern %d: got %s, want %s", i, pattern, expectedExclude[i])
 		}
 	}
-}
\ No newline at end of file
+}
+
+// TestVariables tests saving, listing and removing template variables
+func TestVariables(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	if err := alias.SetVariable("email", "me@example.com"); err != nil {
+		t.Fatalf("SetVariable failed: %v", err)
+	}
+	if err := alias.SetVariable("email", "work@example.com"); err != nil {
+		t.Fatalf("SetVariable failed to replace a value: %v", err)
+	}
+	for _, name := range []string{"", "1st", "has-dash", "with space"} {
+		if err := alias.SetVariable(name, "value"); err == nil {
+			t.Errorf("SetVariable(%q) should reject the name", name)
+		}
+	}
+
+	vars, err := alias.GetVariables()
+	if err != nil {
+		t.Fatalf("GetVariables failed: %v", err)
+	}
+	if len(vars) != 1 || vars["email"] != "work@example.com" {
+		t.Errorf("GetVariables = %v, want email=work@example.com", vars)
+	}
+
+	if err := alias.UnsetVariable("email"); err != nil {
+		t.Fatalf("UnsetVariable failed: %v", err)
+	}
+	if err := alias.UnsetVariable("email"); err != alias.ErrVariableNotFound {
+		t.Errorf("UnsetVariable of a missing variable error = %v, want ErrVariableNotFound", err)
+	}
+}
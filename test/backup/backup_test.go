@@ -0,0 +1,241 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rsvinicius/dotme/internal/backup"
+	"github.com/rsvinicius/dotme/internal/fs"
+)
+
+// writeFile writes a file below dir, creating its parent directories
+func writeFile(t *testing.T, dir, name, content string, mode os.FileMode) {
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create directory for %s: %v", name, err)
+	}
+	if err := os.WriteFile(path, []byte(content), mode); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		t.Fatalf("Failed to change mode of %s: %v", name, err)
+	}
+}
+
+// applyWithBackup copies the dotfiles of srcDir into destDir, recording a backup set
+func applyWithBackup(t *testing.T, srcDir, destDir string) *backup.Set {
+	set := backup.New("https://github.com/user/dotfiles", "main (abc1234)", destDir)
+	err := fs.CopyDotFiles(context.Background(), srcDir, destDir, &fs.CopyOptions{Journal: set.Record})
+	if err != nil {
+		t.Fatalf("CopyDotFiles failed: %v", err)
+	}
+	return set
+}
+
+// TestRestore tests that restoring a backup set reverts an apply
+func TestRestore(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	srcDir := t.TempDir()
+	destDir := t.TempDir()
+	writeFile(t, srcDir, ".bashrc", "incoming", 0644)
+	writeFile(t, srcDir, ".config/a", "a", 0644)
+	writeFile(t, srcDir, ".config/tool/settings.json", "{}", 0644)
+	writeFile(t, srcDir, ".vimrc", "same", 0644)
+	writeFile(t, destDir, ".bashrc", "original", 0600)
+	writeFile(t, destDir, ".vimrc", "same", 0644)
+
+	set := applyWithBackup(t, srcDir, destDir)
+	if set.ID == "" {
+		t.Fatal("Backup set was not saved")
+	}
+	if len(set.Files) != 3 {
+		t.Errorf("Backup set has %d files, want 3 (unchanged files are not recorded)", len(set.Files))
+	}
+
+	latest, err := backup.Latest()
+	if err != nil {
+		t.Fatalf("Latest failed: %v", err)
+	}
+	if latest.ID != set.ID || latest.Repo != set.Repo || latest.Revision != set.Revision || latest.DestDir != destDir {
+		t.Errorf("Latest = %+v, want the saved set %+v", latest, set)
+	}
+
+	if err := latest.Restore(); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(destDir, ".bashrc"))
+	if err != nil {
+		t.Fatalf("Failed to read .bashrc: %v", err)
+	}
+	if string(content) != "original" {
+		t.Errorf(".bashrc content = %q, want %q", string(content), "original")
+	}
+	if info, err := os.Stat(filepath.Join(destDir, ".bashrc")); err == nil && info.Mode().Perm() != 0600 {
+		t.Errorf(".bashrc mode = %v, want %v", info.Mode().Perm(), os.FileMode(0600))
+	}
+	if _, err := os.Stat(filepath.Join(destDir, ".config")); !os.IsNotExist(err) {
+		t.Errorf("Directory created by the apply should be removed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(destDir, ".vimrc")); err != nil {
+		t.Errorf("Unchanged file should be kept: %v", err)
+	}
+
+	if _, err := backup.Latest(); !errors.Is(err, backup.ErrNothingToUndo) {
+		t.Errorf("Latest after restore error = %v, want ErrNothingToUndo", err)
+	}
+}
+
+// TestRestoreRemovesBackupFiles tests that undoing an apply with the backup
+// strategy removes the .bak files it created and keeps older ones
+func TestRestoreRemovesBackupFiles(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	srcDir := t.TempDir()
+	destDir := t.TempDir()
+	writeFile(t, srcDir, ".bashrc", "incoming", 0644)
+	writeFile(t, destDir, ".bashrc", "original", 0644)
+	writeFile(t, destDir, ".bashrc.bak", "older", 0644)
+
+	set := backup.New("https://github.com/user/dotfiles", "main (abc1234)", destDir)
+	options := &fs.CopyOptions{OnConflict: fs.ConflictBackup, Journal: set.Record}
+	if err := fs.CopyDotFiles(context.Background(), srcDir, destDir, options); err != nil {
+		t.Fatalf("CopyDotFiles failed: %v", err)
+	}
+	if content, err := os.ReadFile(filepath.Join(destDir, ".bashrc.bak.1")); err != nil || string(content) != "original" {
+		t.Fatalf(".bashrc.bak.1 content = %q (%v), want %q", string(content), err, "original")
+	}
+
+	if err := set.Restore(); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if content, err := os.ReadFile(filepath.Join(destDir, ".bashrc")); err != nil || string(content) != "original" {
+		t.Errorf(".bashrc content = %q (%v), want %q", string(content), err, "original")
+	}
+	if _, err := os.Lstat(filepath.Join(destDir, ".bashrc.bak.1")); !os.IsNotExist(err) {
+		t.Errorf("Backup file created by the apply should be removed, got %v", err)
+	}
+	if content, err := os.ReadFile(filepath.Join(destDir, ".bashrc.bak")); err != nil || string(content) != "older" {
+		t.Errorf("Existing .bashrc.bak content = %q (%v), want %q", string(content), err, "older")
+	}
+}
+
+// TestBackupWithoutChanges tests that applies that change nothing save no backup set
+func TestBackupWithoutChanges(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	srcDir := t.TempDir()
+	destDir := t.TempDir()
+	writeFile(t, srcDir, ".vimrc", "same", 0644)
+	writeFile(t, destDir, ".vimrc", "same", 0644)
+
+	set := applyWithBackup(t, srcDir, destDir)
+	if set.ID != "" {
+		t.Errorf("Backup set %s saved for an apply without changes", set.ID)
+	}
+
+	sets, err := backup.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(sets) != 0 {
+		t.Errorf("List returned %d sets, want 0", len(sets))
+	}
+}
+
+// TestListAndPrune tests listing backup sets newest first and pruning them
+func TestListAndPrune(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	srcDir := t.TempDir()
+	destDir := t.TempDir()
+
+	writeFile(t, srcDir, ".bashrc", "first", 0644)
+	first := applyWithBackup(t, srcDir, destDir)
+	writeFile(t, srcDir, ".bashrc", "second", 0644)
+	second := applyWithBackup(t, srcDir, destDir)
+
+	sets, err := backup.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(sets) != 2 || sets[0].ID != second.ID || sets[1].ID != first.ID {
+		t.Fatalf("List returned %d sets, want %s then %s", len(sets), second.ID, first.ID)
+	}
+
+	// Undoing twice reverts both applies in reverse order
+	for _, want := range []string{"first", ""} {
+		set, err := backup.Latest()
+		if err != nil {
+			t.Fatalf("Latest failed: %v", err)
+		}
+		if err := set.Restore(); err != nil {
+			t.Fatalf("Restore failed: %v", err)
+		}
+		content, _ := os.ReadFile(filepath.Join(destDir, ".bashrc"))
+		if string(content) != want {
+			t.Errorf(".bashrc content after undo = %q, want %q", string(content), want)
+		}
+	}
+
+	if _, err := backup.Get(first.ID); err != nil {
+		t.Errorf("Get(%q) failed: %v", first.ID, err)
+	}
+	if _, err := backup.Get("missing"); err == nil {
+		t.Error("Get should fail for an unknown backup set")
+	}
+
+	pruned, err := backup.Prune(0)
+	if err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	if len(pruned) != 2 {
+		t.Errorf("Prune removed %d sets, want 2", len(pruned))
+	}
+}
+
+// TestRestoreLinks tests that restoring a linked apply removes the links and
+// restores replaced files and links without touching the linked-to files
+func TestRestoreLinks(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	srcDir := t.TempDir()
+	destDir := t.TempDir()
+	writeFile(t, srcDir, ".bashrc", "incoming", 0644)
+	writeFile(t, srcDir, ".vimrc", "incoming", 0644)
+	writeFile(t, srcDir, ".zshrc", "incoming", 0644)
+	writeFile(t, destDir, ".bashrc", "original", 0600)
+	if err := os.Symlink("/elsewhere/.vimrc", filepath.Join(destDir, ".vimrc")); err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+
+	set := backup.New("https://github.com/user/dotfiles", "main (abc1234)", destDir)
+	options := &fs.CopyOptions{Link: fs.LinkFiles, Journal: set.Record}
+	if err := fs.CopyDotFiles(context.Background(), srcDir, destDir, options); err != nil {
+		t.Fatalf("CopyDotFiles failed: %v", err)
+	}
+	if err := set.Restore(); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	info, err := os.Lstat(filepath.Join(destDir, ".bashrc"))
+	if err != nil || !info.Mode().IsRegular() {
+		t.Fatalf(".bashrc should be a regular file again, got %v", err)
+	}
+	content, _ := os.ReadFile(filepath.Join(destDir, ".bashrc"))
+	if string(content) != "original" || info.Mode().Perm() != 0600 {
+		t.Errorf(".bashrc = %q with mode %v, want %q with mode %v", string(content), info.Mode().Perm(), "original", os.FileMode(0600))
+	}
+	if target, err := os.Readlink(filepath.Join(destDir, ".vimrc")); err != nil || target != "/elsewhere/.vimrc" {
+		t.Errorf(".vimrc links to %q, %v, want the original link", target, err)
+	}
+	if _, err := os.Lstat(filepath.Join(destDir, ".zshrc")); !os.IsNotExist(err) {
+		t.Errorf("Created link should be removed, got %v", err)
+	}
+
+	for _, name := range []string{".bashrc", ".vimrc", ".zshrc"} {
+		content, err := os.ReadFile(filepath.Join(srcDir, name))
+		if err != nil || string(content) != "incoming" {
+			t.Errorf("Source %s = %q, %v, want it untouched", name, string(content), err)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package dotfiles
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/rsvinicius/dotme/internal"
+	"github.com/rsvinicius/dotme/internal/alias"
+	"github.com/rsvinicius/dotme/internal/fs"
+	"github.com/rsvinicius/dotme/test/mocks"
+)
+
+// chdir changes the working directory for the duration of a test
+func chdir(t *testing.T, dir string) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+// assertFile checks that a file exists with the expected content
+func assertFile(t *testing.T, path, expected string) {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Errorf("Failed to read %s: %v", path, err)
+		return
+	}
+	if string(content) != expected {
+		t.Errorf("%s content = %q, want %q", path, string(content), expected)
+	}
+}
+
+// captureStdout returns what fn prints to standard output
+func captureStdout(t *testing.T, fn func()) string {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+	output := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(reader)
+		output <- data
+	}()
+
+	fn()
+	os.Stdout = stdout
+	writer.Close()
+	return string(<-output)
+}
+
+// TestProcessLocalDirectory tests applying dotfiles from a plain local directory
+func TestProcessLocalDirectory(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	srcDir, destDir := mocks.MockRepository(t)
+	defer os.RemoveAll(srcDir)
+	defer os.RemoveAll(destDir)
+	chdir(t, destDir)
+
+	if err := internal.ProcessRepository(context.Background(), srcDir, nil); err != nil {
+		t.Fatalf("ProcessRepository failed: %v", err)
+	}
+
+	assertFile(t, filepath.Join(destDir, ".gitconfig"), "git config content")
+	assertFile(t, filepath.Join(destDir, ".vscode", "settings.json"), "vscode settings")
+	if _, err := os.Stat(filepath.Join(destDir, "README.md")); err == nil {
+		t.Error("README.md should not be copied")
+	}
+
+	if err := internal.ProcessRepository(context.Background(), srcDir, &internal.Options{Ref: "main"}); err == nil {
+		t.Error("--ref should be rejected for a plain directory")
+	}
+}
+
+// TestProcessLocalRepository tests applying dotfiles from a local git repository
+func TestProcessLocalRepository(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	repoDir, commit := mocks.GitRepository(t, map[string]string{".bashrc": "committed"})
+	tagged := commit(map[string]string{".vimrc": "vim"}, "add vimrc")
+
+	// Uncommitted changes are applied from the working tree
+	if err := os.WriteFile(filepath.Join(repoDir, ".bashrc"), []byte("uncommitted"), 0644); err != nil {
+		t.Fatalf("Failed to modify working tree: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		repoURL        string
+		options        *internal.Options
+		expectedBashrc string
+	}{
+		{"working tree path", repoDir, nil, "uncommitted"},
+		{"file URL", "file://" + filepath.ToSlash(repoDir), nil, "uncommitted"},
+		{"ref clones the committed revision", repoDir, &internal.Options{Ref: tagged}, "committed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			destDir := t.TempDir()
+			chdir(t, destDir)
+
+			if err := internal.ProcessRepository(context.Background(), tt.repoURL, tt.options); err != nil {
+				t.Fatalf("ProcessRepository failed: %v", err)
+			}
+
+			assertFile(t, filepath.Join(destDir, ".bashrc"), tt.expectedBashrc)
+			assertFile(t, filepath.Join(destDir, ".vimrc"), "vim")
+			if _, err := os.Stat(filepath.Join(destDir, ".git")); err == nil {
+				t.Error(".git should not be copied")
+			}
+		})
+	}
+}
+
+// TestProcessSameDirectory tests that applying a directory onto itself is rejected
+func TestProcessSameDirectory(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	repoDir, _ := mocks.GitRepository(t, map[string]string{".bashrc": "content"})
+	chdir(t, repoDir)
+
+	if err := internal.ProcessRepository(context.Background(), ".", nil); err == nil {
+		t.Error("ProcessRepository should fail when source and destination are the same")
+	}
+	assertFile(t, filepath.Join(repoDir, ".bashrc"), "content")
+}
+
+// TestProcessTarget tests applying dotfiles to a target directory instead of the current directory
+func TestProcessTarget(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	srcDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, ".bashrc"), []byte("bash"), 0644); err != nil {
+		t.Fatalf("Failed to write .bashrc: %v", err)
+	}
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		target      string
+		create      bool
+		expectedDir string // Directory expected to receive .bashrc
+		expectError bool
+	}{
+		{"home", "~", false, home, false},
+		{"below home", "~/project", true, filepath.Join(home, "project"), false},
+		{"missing without create", filepath.Join(home, "missing"), false, "", true},
+		{"nested missing with create", filepath.Join(home, "a", "b"), true, filepath.Join(home, "a", "b"), false},
+		{"file", file, false, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The current directory must be left alone
+			cwd := t.TempDir()
+			chdir(t, cwd)
+
+			err := internal.ProcessRepository(context.Background(), srcDir, &internal.Options{Target: tt.target, CreateTarget: tt.create})
+			if (err != nil) != tt.expectError {
+				t.Fatalf("ProcessRepository error = %v, expectError %v", err, tt.expectError)
+			}
+			if tt.expectError {
+				if _, err := os.Stat(filepath.Join(home, "missing")); !os.IsNotExist(err) {
+					t.Errorf("Missing target should not be created, got %v", err)
+				}
+				return
+			}
+
+			assertFile(t, filepath.Join(tt.expectedDir, ".bashrc"), "bash")
+			if entries, _ := os.ReadDir(cwd); len(entries) != 0 {
+				t.Errorf("Current directory should be untouched, found %d entries", len(entries))
+			}
+		})
+	}
+}
+
+// TestProcessTemplates tests rendering templates with built-in data and variables
+func TestProcessTemplates(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := alias.SetVariable("name", "saved"); err != nil {
+		t.Fatalf("SetVariable failed: %v", err)
+	}
+	srcDir := t.TempDir()
+	template := "{{ .OS }}/{{ .Arch }} {{ .HomeDir }} {{ .Vars.name }}"
+	if err := os.WriteFile(filepath.Join(srcDir, ".profile.tmpl"), []byte(template), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		vars     []string
+		expected string
+	}{
+		{"saved variable", nil, "saved"},
+		{"flag overrides saved variable", []string{"name=flag"}, "flag"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vars, err := internal.ParseVars(tt.vars)
+			if err != nil {
+				t.Fatalf("ParseVars failed: %v", err)
+			}
+			destDir := t.TempDir()
+			if err := internal.ProcessRepository(context.Background(), srcDir, &internal.Options{Target: destDir, Vars: vars}); err != nil {
+				t.Fatalf("ProcessRepository failed: %v", err)
+			}
+			assertFile(t, filepath.Join(destDir, ".profile"), runtime.GOOS+"/"+runtime.GOARCH+" "+home+" "+tt.expected)
+		})
+	}
+
+	for _, arg := range []string{"missing-equals", "bad-name=value", "=value"} {
+		if _, err := internal.ParseVars([]string{arg}); err == nil {
+			t.Errorf("ParseVars(%q) should fail", arg)
+		}
+	}
+}
+
+// TestDiffMergeRule tests that files matched by a merge rule are diffed
+// against the merged content instead of being shown as overwritten
+func TestDiffMergeRule(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	srcDir := t.TempDir()
+	destDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(srcDir, ".vscode"), 0755); err != nil {
+		t.Fatalf("Failed to create source directory: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(destDir, ".vscode"), 0755); err != nil {
+		t.Fatalf("Failed to create destination directory: %v", err)
+	}
+	incoming := "{\n  \"editor.tabSize\": 2\n}\n"
+	existing := "{\n  \"editor.fontSize\": 14\n}\n"
+	if err := os.WriteFile(filepath.Join(srcDir, ".vscode", "settings.json"), []byte(incoming), 0644); err != nil {
+		t.Fatalf("Failed to write settings: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(destDir, ".vscode", "settings.json"), []byte(existing), 0644); err != nil {
+		t.Fatalf("Failed to write settings: %v", err)
+	}
+
+	rule, err := fs.ParseConflictRule("merge:.vscode/*.json")
+	if err != nil {
+		t.Fatalf("ParseConflictRule failed: %v", err)
+	}
+	options := &internal.Options{Target: destDir, ConflictRules: []fs.ConflictRule{rule}}
+
+	var diffErr error
+	output := captureStdout(t, func() {
+		diffErr = internal.DiffRepository(context.Background(), srcDir, options)
+	})
+	if diffErr != nil {
+		t.Fatalf("DiffRepository failed: %v", diffErr)
+	}
+	for _, line := range []string{`+  "editor.fontSize": 14,`, `+  "editor.tabSize": 2`} {
+		if !strings.Contains(output, line) {
+			t.Errorf("Diff of the merged file should contain %q:\n%s", line, output)
+		}
+	}
+	assertFile(t, filepath.Join(destDir, ".vscode", "settings.json"), existing)
+}
+
+// TestDiffBlockRule tests that files matched by a block rule are diffed with
+// the managed block named after the alias
+func TestDiffBlockRule(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	srcDir := t.TempDir()
+	destDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, ".bashrc"), []byte("alias ll='ls -l'\n"), 0644); err != nil {
+		t.Fatalf("Failed to write .bashrc: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(destDir, ".bashrc"), []byte("export EDITOR=vim\n"), 0644); err != nil {
+		t.Fatalf("Failed to write .bashrc: %v", err)
+	}
+
+	rule, err := fs.ParseConflictRule("block:.bashrc")
+	if err != nil {
+		t.Fatalf("ParseConflictRule failed: %v", err)
+	}
+	options := &internal.Options{Target: destDir, Alias: "work", ConflictRules: []fs.ConflictRule{rule}}
+
+	var diffErr error
+	output := captureStdout(t, func() {
+		diffErr = internal.DiffRepository(context.Background(), srcDir, options)
+	})
+	if diffErr != nil {
+		t.Fatalf("DiffRepository failed: %v", diffErr)
+	}
+	for _, line := range []string{" export EDITOR=vim", "+# >>> dotme:work >>>", "+alias ll='ls -l'", "+# <<< dotme:work <<<"} {
+		if !strings.Contains(output, line) {
+			t.Errorf("Diff of the managed block should contain %q:\n%s", line, output)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package fs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rsvinicius/dotme/internal/fs"
+)
+
+// TestWriteBlock tests writing managed blocks into existing content
+func TestWriteBlock(t *testing.T) {
+	const begin, end = "# >>> dotme:work >>>\n", "# <<< dotme:work <<<\n"
+	tests := []struct {
+		name          string
+		existing      string
+		content       string
+		expected      string
+		expectedError string
+	}{
+		{
+			name:     "new file",
+			content:  "export EDITOR=vim\n",
+			expected: begin + "export EDITOR=vim\n" + end,
+		},
+		{
+			name:     "appended after local content",
+			existing: "alias ll='ls -l'",
+			content:  "export EDITOR=vim",
+			expected: "alias ll='ls -l'\n\n" + begin + "export EDITOR=vim\n" + end,
+		},
+		{
+			name:     "existing block replaced in place",
+			existing: "# local\n" + begin + "old\n" + end + "# more local\n",
+			content:  "new\n",
+			expected: "# local\n" + begin + "new\n" + end + "# more local\n",
+		},
+		{
+			name:     "other blocks kept",
+			existing: "# >>> dotme:home >>>\nhome\n# <<< dotme:home <<<\n",
+			content:  "work\n",
+			expected: "# >>> dotme:home >>>\nhome\n# <<< dotme:home <<<\n\n" + begin + "work\n" + end,
+		},
+		{
+			name:          "unclosed block",
+			existing:      begin + "old\n",
+			content:       "new\n",
+			expectedError: "never closed",
+		},
+		{
+			name:          "block opened twice",
+			existing:      begin + begin + end,
+			content:       "new\n",
+			expectedError: "opened twice",
+		},
+		{
+			name:          "closed before opened",
+			existing:      end + begin,
+			content:       "new\n",
+			expectedError: "closed before it is opened",
+		},
+		{
+			name:          "duplicated end marker",
+			existing:      begin + "old\n" + end + end,
+			content:       "new\n",
+			expectedError: "more than one end marker",
+		},
+		{
+			name:          "content with markers",
+			content:       begin + "new\n" + end,
+			expectedError: "contains the markers",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := fs.WriteBlock([]byte(tt.existing), []byte(tt.content), "work")
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("WriteBlock error = %v, want one containing %q", err, tt.expectedError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("WriteBlock failed: %v", err)
+			}
+			if string(out) != tt.expected {
+				t.Errorf("WriteBlock =\n%q\nwant\n%q", out, tt.expected)
+			}
+
+			// Writing the same content again changes nothing
+			again, err := fs.WriteBlock(out, []byte(tt.content), "work")
+			if err != nil || string(again) != string(out) {
+				t.Errorf("Writing again = %q, %v, want %q", again, err, out)
+			}
+		})
+	}
+}
+
+// TestCopyDotFilesBlock tests applying dotfiles into managed blocks
+func TestCopyDotFilesBlock(t *testing.T) {
+	srcDir := t.TempDir()
+	destDir := t.TempDir()
+	writeFiles(t, srcDir, map[string]string{".bashrc": "export EDITOR=vim\n", ".editorconfig": "root = true\n"}, 0644)
+	writeFiles(t, destDir, map[string]string{".bashrc": "alias ll='ls -l'\n"}, 0600)
+
+	options := &fs.CopyOptions{
+		ConflictRules: []fs.ConflictRule{{Pattern: ".*", Strategy: fs.ConflictBlock}},
+		BlockName:     "dotfiles",
+	}
+	if err := fs.CopyDotFiles(context.Background(), srcDir, destDir, options); err != nil {
+		t.Fatalf("CopyDotFiles failed: %v", err)
+	}
+
+	expected := map[string]string{
+		".bashrc":       "alias ll='ls -l'\n\n# >>> dotme:dotfiles >>>\nexport EDITOR=vim\n# <<< dotme:dotfiles <<<\n",
+		".editorconfig": "# >>> dotme:dotfiles >>>\nroot = true\n# <<< dotme:dotfiles <<<\n",
+	}
+	for name, want := range expected {
+		content, err := os.ReadFile(filepath.Join(destDir, name))
+		if err != nil || string(content) != want {
+			t.Errorf("%s content = %q, %v, want %q", name, string(content), err, want)
+		}
+	}
+
+	// Applying again leaves both files unchanged
+	plan, err := fs.PlanDotFiles(context.Background(), srcDir, destDir, options)
+	if err != nil {
+		t.Fatalf("PlanDotFiles failed: %v", err)
+	}
+	defer plan.Close()
+	for _, action := range plan.Actions {
+		if action.Change != fs.ChangeUnchanged {
+			t.Errorf("%s change = %v on second apply, want unchanged", action.Path, action.Change)
+		}
+	}
+
+	// Changes in the repository only replace the block, keeping local edits
+	writeFiles(t, srcDir, map[string]string{".bashrc": "export EDITOR=nvim\n"}, 0644)
+	bashrc := filepath.Join(destDir, ".bashrc")
+	local, _ := os.ReadFile(bashrc)
+	if err := os.WriteFile(bashrc, append(local, "export PATH=$PATH:~/bin\n"...), 0600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := fs.CopyDotFiles(context.Background(), srcDir, destDir, options); err != nil {
+		t.Fatalf("CopyDotFiles failed: %v", err)
+	}
+	want := "alias ll='ls -l'\n\n# >>> dotme:dotfiles >>>\nexport EDITOR=nvim\n# <<< dotme:dotfiles <<<\nexport PATH=$PATH:~/bin\n"
+	if content, err := os.ReadFile(bashrc); err != nil || string(content) != want {
+		t.Errorf(".bashrc content = %q, %v, want %q", string(content), err, want)
+	}
+}
+
+// TestCopyDotFilesBlockIdenticalFile tests that a file already holding the
+// incoming content still gets the managed block, so later changes replace it
+func TestCopyDotFilesBlockIdenticalFile(t *testing.T) {
+	srcDir := t.TempDir()
+	destDir := t.TempDir()
+	writeFiles(t, srcDir, map[string]string{".bashrc": "export EDITOR=vim\n"}, 0644)
+	writeFiles(t, destDir, map[string]string{".bashrc": "export EDITOR=vim\n"}, 0644)
+
+	options := &fs.CopyOptions{
+		ConflictRules: []fs.ConflictRule{{Pattern: ".bashrc", Strategy: fs.ConflictBlock}},
+		BlockName:     "dotfiles",
+	}
+	plan, err := fs.PlanDotFiles(context.Background(), srcDir, destDir, options)
+	if err != nil {
+		t.Fatalf("PlanDotFiles failed: %v", err)
+	}
+	plan.Close()
+	if len(plan.Actions) != 1 || plan.Actions[0].Change != fs.ChangeOverwrite {
+		t.Fatalf("Actions = %+v, want a single overwrite writing the block", plan.Actions)
+	}
+
+	for _, content := range []string{"export EDITOR=vim\n", "export EDITOR=nvim\n"} {
+		writeFiles(t, srcDir, map[string]string{".bashrc": content}, 0644)
+		if err := fs.CopyDotFiles(context.Background(), srcDir, destDir, options); err != nil {
+			t.Fatalf("CopyDotFiles failed: %v", err)
+		}
+		want := "export EDITOR=vim\n\n# >>> dotme:dotfiles >>>\n" + content + "# <<< dotme:dotfiles <<<\n"
+		if got, err := os.ReadFile(filepath.Join(destDir, ".bashrc")); err != nil || string(got) != want {
+			t.Errorf(".bashrc content = %q, %v, want %q", string(got), err, want)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package fs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rsvinicius/dotme/internal/fs"
+)
+
+// TestParseConflictStrategy tests parsing conflict strategy names
+func TestParseConflictStrategy(t *testing.T) {
+	tests := []struct {
+		name        string
+		expected    fs.ConflictStrategy
+		expectError bool
+	}{
+		{"", fs.ConflictOverwrite, false},
+		{"overwrite", fs.ConflictOverwrite, false},
+		{"skip", fs.ConflictSkip, false},
+		{"backup", fs.ConflictBackup, false},
+		{"prompt", fs.ConflictPrompt, false},
+		{"fail", fs.ConflictFail, false},
+		{"merge", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strategy, err := fs.ParseConflictStrategy(tt.name)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("ParseConflictStrategy(%q) error = %v, expectError %v", tt.name, err, tt.expectError)
+			}
+			if strategy != tt.expected {
+				t.Errorf("ParseConflictStrategy(%q) = %q, want %q", tt.name, strategy, tt.expected)
+			}
+		})
+	}
+}
+
+// TestCopyDotFilesOnConflict tests each conflict strategy against an existing file
+func TestCopyDotFilesOnConflict(t *testing.T) {
+	tests := []struct {
+		name            string
+		strategy        fs.ConflictStrategy
+		resolve         fs.ConflictResolver
+		expectError     bool
+		expectedContent string
+		expectedNew     bool
+		expectedBackup  bool
+	}{
+		{"default", "", nil, false, "incoming", true, false},
+		{"overwrite", fs.ConflictOverwrite, nil, false, "incoming", true, false},
+		{"skip", fs.ConflictSkip, nil, false, "existing", true, false},
+		{"backup", fs.ConflictBackup, nil, false, "incoming", true, true},
+		{"fail", fs.ConflictFail, nil, true, "existing", false, false},
+		{"prompt keep", fs.ConflictPrompt, func(*fs.FileAction) (fs.ConflictStrategy, error) {
+			return fs.ConflictSkip, nil
+		}, false, "existing", true, false},
+		{"prompt abort", fs.ConflictPrompt, func(*fs.FileAction) (fs.ConflictStrategy, error) {
+			return fs.ConflictFail, nil
+		}, true, "existing", false, false},
+		{"prompt without resolver", fs.ConflictPrompt, nil, true, "existing", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srcDir := t.TempDir()
+			destDir := t.TempDir()
+			writeFiles(t, srcDir, map[string]string{".bashrc": "incoming", ".aaa": "new"}, 0644)
+			writeFiles(t, destDir, map[string]string{".bashrc": "existing"}, 0644)
+
+			err := fs.CopyDotFiles(context.Background(), srcDir, destDir, &fs.CopyOptions{
+				OnConflict: tt.strategy,
+				Resolve:    tt.resolve,
+			})
+			if (err != nil) != tt.expectError {
+				t.Fatalf("CopyDotFiles error = %v, expectError %v", err, tt.expectError)
+			}
+
+			content, err := os.ReadFile(filepath.Join(destDir, ".bashrc"))
+			if err != nil {
+				t.Fatalf("Failed to read .bashrc: %v", err)
+			}
+			if string(content) != tt.expectedContent {
+				t.Errorf(".bashrc content = %q, want %q", string(content), tt.expectedContent)
+			}
+
+			if _, err := os.Stat(filepath.Join(destDir, ".aaa")); (err == nil) != tt.expectedNew {
+				t.Errorf(".aaa exists = %v, want %v", err == nil, tt.expectedNew)
+			}
+
+			backup, err := os.ReadFile(filepath.Join(destDir, ".bashrc.bak"))
+			if (err == nil) != tt.expectedBackup {
+				t.Fatalf(".bashrc.bak exists = %v, want %v", err == nil, tt.expectedBackup)
+			}
+			if tt.expectedBackup && string(backup) != "existing" {
+				t.Errorf(".bashrc.bak content = %q, want %q", string(backup), "existing")
+			}
+		})
+	}
+}
+
+// TestCopyDirBackupNames tests that existing backups are never overwritten
+func TestCopyDirBackupNames(t *testing.T) {
+	srcDir := t.TempDir()
+	destDir := t.TempDir()
+	writeFiles(t, srcDir, map[string]string{"config": "incoming"}, 0644)
+	writeFiles(t, destDir, map[string]string{"config": "existing", "config.bak": "older"}, 0644)
+
+	if err := fs.CopyDir(srcDir, destDir, &fs.CopyOptions{OnConflict: fs.ConflictBackup}); err != nil {
+		t.Fatalf("CopyDir failed: %v", err)
+	}
+
+	expected := map[string]string{"config": "incoming", "config.bak": "older", "config.bak.1": "existing"}
+	for name, want := range expected {
+		content, err := os.ReadFile(filepath.Join(destDir, name))
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", name, err)
+		}
+		if string(content) != want {
+			t.Errorf("%s content = %q, want %q", name, string(content), want)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package fs
 
 import (
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -28,7 +30,7 @@ func TestCopyFile(t *testing.T) {
 
 	// Copy the file
 	destFile := filepath.Join(tempDir, "dest.txt")
-	err = fs.CopyFile(srcFile, destFile)
+	err = fs.CopyFile(srcFile, destFile, nil)
 	if err != nil {
 		t.Fatalf("CopyFile failed: %v", err)
 	}
@@ -76,7 +78,7 @@ func TestCopyDir(t *testing.T) {
 
 	// Copy the directory
 	destDir := filepath.Join(tempDir, "dest")
-	err = fs.CopyDir(srcDir, destDir)
+	err = fs.CopyDir(srcDir, destDir, nil)
 	if err != nil {
 		t.Fatalf("CopyDir failed: %v", err)
 	}
@@ -94,6 +96,17 @@ func TestCopyDir(t *testing.T) {
 			t.Errorf("File %s content = %q, want %q", file, string(content), expectedContent)
 		}
 	}
+
+	// Git metadata of nested repositories, such as submodules, is not copied
+	if err := os.WriteFile(filepath.Join(srcDir, "subdir", ".git"), []byte("gitdir: ../.git/modules/subdir"), 0644); err != nil {
+		t.Fatalf("Failed to create .git file: %v", err)
+	}
+	if err := fs.CopyDir(srcDir, destDir, nil); err != nil {
+		t.Fatalf("CopyDir failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "subdir", ".git")); !os.IsNotExist(err) {
+		t.Error("Nested .git file should not be copied")
+	}
 }
 
 // TestCopyDotFiles tests the dotfile filtering and copying logic with patterns
@@ -214,7 +227,7 @@ func TestCopyDotFiles(t *testing.T) {
 			}
 
 			// Copy dotfiles
-			err = fs.CopyDotFiles(srcDir, destDir, filterOptions)
+			err = fs.CopyDotFiles(context.Background(), srcDir, destDir, &fs.CopyOptions{Filter: filterOptions})
 			if err != nil {
 				t.Fatalf("CopyDotFiles failed: %v", err)
 			}
@@ -236,4 +249,74 @@ func TestCopyDotFiles(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+// TestCopyDotFilesCancelled tests that nothing is written once the context is cancelled
+func TestCopyDotFilesCancelled(t *testing.T) {
+	srcDir := t.TempDir()
+	destDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, ".bashrc"), []byte("bash config"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := fs.CopyDotFiles(ctx, srcDir, destDir, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("CopyDotFiles error = %v, want %v", err, context.Canceled)
+	}
+	if entries, _ := os.ReadDir(destDir); len(entries) != 0 {
+		t.Errorf("Destination should be untouched, found %v", entries)
+	}
+}
+
+// TestCopyDotFilesRollback tests that a failure on a later file leaves the destination untouched
+func TestCopyDotFilesRollback(t *testing.T) {
+	srcDir := t.TempDir()
+	destDir := t.TempDir()
+	writeFiles(t, srcDir, map[string]string{
+		".a":       "new",
+		".b":       "incoming",
+		".c/d/e":   "nested",
+		".z/fails": "last",
+	}, 0644)
+	writeFiles(t, destDir, map[string]string{".b": "original"}, 0600)
+
+	failing := func(ctx context.Context, action *fs.FileAction) error {
+		if action.Path == ".z/fails" {
+			return errors.New("permission denied")
+		}
+		return nil
+	}
+	err := fs.CopyDotFiles(context.Background(), srcDir, destDir, &fs.CopyOptions{Journal: failing})
+	if err == nil {
+		t.Fatal("CopyDotFiles should fail when a file cannot be written")
+	}
+	if errors.Is(err, fs.ErrPartialApply) {
+		t.Errorf("Rollback should succeed, got %v", err)
+	}
+
+	entries, err := os.ReadDir(destDir)
+	if err != nil {
+		t.Fatalf("Failed to read destination: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != ".b" {
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		t.Errorf("Destination contains %v, want only .b", names)
+	}
+
+	content, err := os.ReadFile(filepath.Join(destDir, ".b"))
+	if err != nil {
+		t.Fatalf("Failed to read .b: %v", err)
+	}
+	if string(content) != "original" {
+		t.Errorf(".b content = %q, want %q", string(content), "original")
+	}
+	if info, err := os.Stat(filepath.Join(destDir, ".b")); err == nil && info.Mode().Perm() != 0600 {
+		t.Errorf(".b mode = %v, want %v", info.Mode().Perm(), os.FileMode(0600))
+	}
+}
@@ -0,0 +1,132 @@
+package fs
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/rsvinicius/dotme/internal/fs"
+)
+
+// planAction plans a single dotfile and returns its action
+func planAction(t *testing.T, name string, src, dest map[string]string) *fs.FileAction {
+	srcDir := t.TempDir()
+	destDir := t.TempDir()
+	writeFiles(t, srcDir, src, 0644)
+	writeFiles(t, destDir, dest, 0644)
+
+	plan, err := fs.PlanDotFiles(context.Background(), srcDir, destDir, nil)
+	if err != nil {
+		t.Fatalf("PlanDotFiles failed: %v", err)
+	}
+	t.Cleanup(plan.Close)
+
+	for _, action := range plan.Actions {
+		if action.Path == name {
+			return action
+		}
+	}
+	t.Fatalf("Plan has no action for %s", name)
+	return nil
+}
+
+// TestWriteDiff tests the unified diff of new, changed and binary files
+func TestWriteDiff(t *testing.T) {
+	oldLines := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\n"
+	newLines := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\n"
+
+	tests := []struct {
+		name     string
+		src      string
+		dest     map[string]string
+		expected string
+	}{
+		{
+			"new file",
+			"one\ntwo\n",
+			nil,
+			"diff a/.bashrc b/.bashrc\nnew file mode 0644\n--- /dev/null\n+++ b/.bashrc\n@@ -0,0 +1,2 @@\n+one\n+two\n",
+		},
+		{
+			"changed lines in separate hunks",
+			newLines,
+			map[string]string{".bashrc": oldLines},
+			"diff a/.bashrc b/.bashrc\n--- a/.bashrc\n+++ b/.bashrc\n" +
+				"@@ -1,5 +1,5 @@\n a\n-b\n+B\n c\n d\n e\n" +
+				"@@ -10,3 +10,4 @@\n j\n k\n l\n+m\n",
+		},
+		{
+			"missing final newline",
+			"x\ny",
+			map[string]string{".bashrc": "x\ny\n"},
+			"diff a/.bashrc b/.bashrc\n--- a/.bashrc\n+++ b/.bashrc\n" +
+				"@@ -1,2 +1,2 @@\n x\n-y\n+y\n\\ No newline at end of file\n",
+		},
+		{
+			"binary file",
+			"\x00\x01\x02",
+			map[string]string{".bashrc": "text\n"},
+			"diff a/.bashrc b/.bashrc\nBinary files a/.bashrc and b/.bashrc differ (5 B → 3 B)\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action := planAction(t, ".bashrc", map[string]string{".bashrc": tt.src}, tt.dest)
+
+			var out bytes.Buffer
+			if err := fs.WriteDiff(&out, action, false, false); err != nil {
+				t.Fatalf("WriteDiff failed: %v", err)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("WriteDiff output:\n%s\nwant:\n%s", out.String(), tt.expected)
+			}
+		})
+	}
+}
+
+// TestWriteDiffColor tests that removed, added and hunk lines are colored
+func TestWriteDiffColor(t *testing.T) {
+	action := planAction(t, ".bashrc", map[string]string{".bashrc": "new\n"}, map[string]string{".bashrc": "old\n"})
+
+	var out bytes.Buffer
+	if err := fs.WriteDiff(&out, action, true, false); err != nil {
+		t.Fatalf("WriteDiff failed: %v", err)
+	}
+	for _, expected := range []string{"\x1b[31m-old\x1b[0m", "\x1b[32m+new\x1b[0m", "\x1b[36m@@ -1,1 +1,1 @@\x1b[0m"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("WriteDiff output %q does not contain %q", out.String(), expected)
+		}
+	}
+}
+
+// TestPrintDiffs tests that unchanged files are skipped and mode changes are reported
+func TestPrintDiffs(t *testing.T) {
+	srcDir := t.TempDir()
+	destDir := t.TempDir()
+	writeFiles(t, srcDir, map[string]string{".editorconfig": "root = true"}, 0644)
+	writeFiles(t, srcDir, map[string]string{".local/bin/tool": "#!/bin/sh"}, 0755)
+	writeFiles(t, destDir, map[string]string{".editorconfig": "root = true"}, 0644)
+	writeFiles(t, destDir, map[string]string{".local/bin/tool": "#!/bin/sh"}, 0644)
+
+	plan, err := fs.PlanDotFiles(context.Background(), srcDir, destDir, nil)
+	if err != nil {
+		t.Fatalf("PlanDotFiles failed: %v", err)
+	}
+	defer plan.Close()
+
+	var out bytes.Buffer
+	changed, err := fs.PrintDiffs(&out, plan.Actions, false, false)
+	if err != nil {
+		t.Fatalf("PrintDiffs failed: %v", err)
+	}
+	if changed != 1 {
+		t.Errorf("PrintDiffs reported %d changed files, want 1", changed)
+	}
+
+	expected := "diff a/.local/bin/tool b/.local/bin/tool\nold mode 0644\nnew mode 0755\n"
+	if out.String() != expected {
+		t.Errorf("PrintDiffs output:\n%s\nwant:\n%s", out.String(), expected)
+	}
+}
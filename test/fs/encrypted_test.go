@@ -0,0 +1,202 @@
+package fs
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rsvinicius/dotme/internal/fs"
+	"github.com/rsvinicius/dotme/internal/secret"
+)
+
+// TestCopyDotFilesEncrypted tests that .enc files are decrypted and written
+// without the suffix, with mode 0600
+func TestCopyDotFilesEncrypted(t *testing.T) {
+	key := []byte("test secret")
+	encrypt := func(plaintext string) string {
+		encrypted, err := secret.Encrypt([]byte(plaintext), key)
+		if err != nil {
+			t.Fatalf("Encrypt failed: %v", err)
+		}
+		return string(encrypted)
+	}
+	decrypt := func(data []byte) ([]byte, error) {
+		return secret.Decrypt(data, key)
+	}
+
+	tests := []struct {
+		name string
+		link fs.LinkMode
+	}{
+		{"copy", fs.LinkNone},
+		{"link", fs.LinkFiles},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srcDir := t.TempDir()
+			destDir := t.TempDir()
+			writeFiles(t, srcDir, map[string]string{
+				".npmrc.enc":          encrypt("token=secret"),
+				".gitconfig.tmpl.enc": encrypt("email = {{ .Vars.email }}"),
+			}, 0644)
+
+			options := &fs.CopyOptions{
+				Link:         tt.link,
+				Decrypt:      decrypt,
+				TemplateData: map[string]any{"Vars": map[string]string{"email": "me@example.com"}},
+			}
+			if err := fs.CopyDotFiles(context.Background(), srcDir, destDir, options); err != nil {
+				t.Fatalf("CopyDotFiles failed: %v", err)
+			}
+
+			expected := map[string]string{".npmrc": "token=secret", ".gitconfig": "email = me@example.com"}
+			for name, want := range expected {
+				path := filepath.Join(destDir, name)
+				info, err := os.Lstat(path)
+				if err != nil || !info.Mode().IsRegular() {
+					t.Fatalf("%s should be a regular file, got %v", name, err)
+				}
+				if info.Mode().Perm() != 0600 {
+					t.Errorf("%s mode = %v, want 0600", name, info.Mode().Perm())
+				}
+				content, _ := os.ReadFile(path)
+				if string(content) != want {
+					t.Errorf("%s content = %q, want %q", name, string(content), want)
+				}
+			}
+			if _, err := os.Lstat(filepath.Join(destDir, ".npmrc.enc")); !os.IsNotExist(err) {
+				t.Errorf(".npmrc.enc should not be written, got %v", err)
+			}
+
+			// Applying again leaves everything unchanged
+			plan, err := fs.PlanDotFiles(context.Background(), srcDir, destDir, options)
+			if err != nil {
+				t.Fatalf("PlanDotFiles failed: %v", err)
+			}
+			defer plan.Close()
+			for _, action := range plan.Actions {
+				if action.Change != fs.ChangeUnchanged {
+					t.Errorf("%s change = %v on second apply, want unchanged", action.Path, action.Change)
+				}
+			}
+		})
+	}
+}
+
+// TestCopyDotFilesEncryptedErrors tests that encrypted files that cannot be
+// decrypted leave the destination untouched
+func TestCopyDotFilesEncryptedErrors(t *testing.T) {
+	encrypted, err := secret.Encrypt([]byte("token=secret"), []byte("test secret"))
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		decrypt fs.Decrypter
+	}{
+		{"no key", nil},
+		{"wrong key", func(data []byte) ([]byte, error) { return secret.Decrypt(data, []byte("wrong")) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srcDir := t.TempDir()
+			destDir := t.TempDir()
+			writeFiles(t, srcDir, map[string]string{".bashrc": "alias", ".npmrc.enc": string(encrypted)}, 0644)
+
+			err := fs.CopyDotFiles(context.Background(), srcDir, destDir, &fs.CopyOptions{Decrypt: tt.decrypt})
+			if err == nil {
+				t.Fatal("CopyDotFiles should fail when a file cannot be decrypted")
+			}
+
+			entries, _ := os.ReadDir(destDir)
+			if len(entries) != 0 {
+				t.Errorf("Destination should be untouched, found %d entries", len(entries))
+			}
+		})
+	}
+}
+
+// TestCopyDotFilesBareEncSuffix tests that a file named just .enc is copied as
+// is instead of being decrypted onto its parent directory
+func TestCopyDotFilesBareEncSuffix(t *testing.T) {
+	srcDir := t.TempDir()
+	destDir := t.TempDir()
+	writeFiles(t, srcDir, map[string]string{".config/.enc": "plain"}, 0644)
+
+	if err := fs.CopyDotFiles(context.Background(), srcDir, destDir, &fs.CopyOptions{}); err != nil {
+		t.Fatalf("CopyDotFiles failed: %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(destDir, ".config", ".enc"))
+	if err != nil || string(content) != "plain" {
+		t.Errorf(".config/.enc content = %q, err = %v, want %q", string(content), err, "plain")
+	}
+}
+
+// TestPrintDiffsSecrets tests that diffs of decrypted files only show content
+// hashes unless secrets are shown
+func TestPrintDiffsSecrets(t *testing.T) {
+	key := []byte("test secret")
+	encrypted, err := secret.Encrypt([]byte("token=new-secret\n"), key)
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	srcDir := t.TempDir()
+	destDir := t.TempDir()
+	writeFiles(t, srcDir, map[string]string{".npmrc.enc": string(encrypted), ".netrc.enc": string(encrypted)}, 0644)
+	writeFiles(t, destDir, map[string]string{".npmrc": "token=old-secret\n"}, 0600)
+
+	options := &fs.CopyOptions{Decrypt: func(data []byte) ([]byte, error) { return secret.Decrypt(data, key) }}
+	plan, err := fs.PlanDotFiles(context.Background(), srcDir, destDir, options)
+	if err != nil {
+		t.Fatalf("PlanDotFiles failed: %v", err)
+	}
+	defer plan.Close()
+
+	tests := []struct {
+		name        string
+		showSecrets bool
+		contains    []string
+		excludes    []string
+	}{
+		{
+			name:     "hidden",
+			contains: []string{"Secret file b/.npmrc changed (sha256:", "Secret file b/.netrc added (sha256:", "--show-secrets"},
+			excludes: []string{"old-secret", "new-secret"},
+		},
+		{
+			name:        "shown",
+			showSecrets: true,
+			contains:    []string{"-token=old-secret", "+token=new-secret"},
+			excludes:    []string{"Secret file"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			changed, err := fs.PrintDiffs(&out, plan.Actions, false, tt.showSecrets)
+			if err != nil {
+				t.Fatalf("PrintDiffs failed: %v", err)
+			}
+			if changed != 2 {
+				t.Errorf("PrintDiffs reported %d changed files, want 2", changed)
+			}
+			for _, text := range tt.contains {
+				if !strings.Contains(out.String(), text) {
+					t.Errorf("Diff output should contain %q:\n%s", text, out.String())
+				}
+			}
+			for _, text := range tt.excludes {
+				if strings.Contains(out.String(), text) {
+					t.Errorf("Diff output should not contain %q:\n%s", text, out.String())
+				}
+			}
+		})
+	}
+}
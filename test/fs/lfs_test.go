@@ -0,0 +1,166 @@
+package fs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rsvinicius/dotme/internal/fs"
+)
+
+// lfsPointer returns the pointer file content for the given object content
+func lfsPointer(content string) (string, string) {
+	sum := sha256.Sum256([]byte(content))
+	oid := hex.EncodeToString(sum[:])
+	return fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid sha256:%s\nsize %d\n", oid, len(content)), oid
+}
+
+func TestParseLFSPointer(t *testing.T) {
+	pointer, oid := lfsPointer("font data")
+
+	tests := []struct {
+		name      string
+		data      string
+		expectOk  bool
+		expectOid string
+	}{
+		{"valid pointer", pointer, true, oid},
+		{"plain text", "set number\n", false, ""},
+		{"missing size", strings.Replace(pointer, "size 9\n", "", 1), false, ""},
+		{"invalid oid", strings.Replace(pointer, oid, "abc", 1), false, ""},
+		{"oversized", pointer + strings.Repeat("x", 2048), false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, ok := fs.ParseLFSPointer([]byte(tt.data))
+			if ok != tt.expectOk {
+				t.Fatalf("ParseLFSPointer ok = %v, want %v", ok, tt.expectOk)
+			}
+			if ok && (result.Oid != tt.expectOid || result.Size != 9) {
+				t.Errorf("ParseLFSPointer = %+v, want oid %s and size 9", result, tt.expectOid)
+			}
+		})
+	}
+}
+
+// TestCopyDotFilesLFS tests that LFS pointer files are replaced by their
+// objects or refused before anything is copied
+func TestCopyDotFilesLFS(t *testing.T) {
+	srcDir := t.TempDir()
+	pointer, oid := lfsPointer("font data")
+	files := map[string]string{
+		".bashrc":             "bash config",
+		".idea/fonts/a.ttf":   pointer,
+		".idea/workspace.xml": "<project/>",
+	}
+	for name, content := range files {
+		path := filepath.Join(srcDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	t.Run("refused without fetcher", func(t *testing.T) {
+		destDir := t.TempDir()
+		err := fs.CopyDotFiles(context.Background(), srcDir, destDir, nil)
+		if err == nil {
+			t.Fatal("CopyDotFiles should refuse LFS pointer files")
+		}
+		if !strings.Contains(err.Error(), ".idea/fonts/a.ttf") {
+			t.Errorf("Error %q should list the pointer file", err)
+		}
+		if _, err := os.Stat(filepath.Join(destDir, ".bashrc")); !os.IsNotExist(err) {
+			t.Error("Nothing should be copied when pointer files are refused")
+		}
+	})
+
+	t.Run("failed fetch", func(t *testing.T) {
+		destDir := t.TempDir()
+		fetch := func(ctx context.Context, oid string, size int64, dst string) error {
+			return fmt.Errorf("object not found")
+		}
+		err := fs.CopyDotFiles(context.Background(), srcDir, destDir, &fs.CopyOptions{LFS: fetch})
+		if err == nil || !strings.Contains(err.Error(), ".idea/fonts/a.ttf") {
+			t.Fatalf("CopyDotFiles error = %v, want one listing the pointer file", err)
+		}
+		if _, err := os.Stat(filepath.Join(destDir, ".bashrc")); !os.IsNotExist(err) {
+			t.Error("Nothing should be copied when an object cannot be fetched")
+		}
+	})
+
+	t.Run("fetched", func(t *testing.T) {
+		destDir := t.TempDir()
+		fetch := func(ctx context.Context, requested string, size int64, dst string) error {
+			if requested != oid || size != 9 {
+				return fmt.Errorf("unexpected object %s (%d bytes)", requested, size)
+			}
+			return os.WriteFile(dst, []byte("font data"), 0644)
+		}
+		if err := fs.CopyDotFiles(context.Background(), srcDir, destDir, &fs.CopyOptions{LFS: fetch}); err != nil {
+			t.Fatalf("CopyDotFiles failed: %v", err)
+		}
+
+		target := filepath.Join(destDir, ".idea", "fonts", "a.ttf")
+		content, err := os.ReadFile(target)
+		if err != nil {
+			t.Fatalf("Failed to read fetched file: %v", err)
+		}
+		if string(content) != "font data" {
+			t.Errorf("Fetched file content = %q, want %q", string(content), "font data")
+		}
+		if info, err := os.Stat(target); err == nil && info.Mode().Perm() != 0600 {
+			t.Errorf("Fetched file mode = %v, want %v", info.Mode().Perm(), os.FileMode(0600))
+		}
+	})
+}
+
+// TestCopyDotFilesLFSSymlinks tests that LFS pointer files behind followed
+// symbolic links are replaced by their objects
+func TestCopyDotFilesLFSSymlinks(t *testing.T) {
+	root := t.TempDir()
+	srcDir := filepath.Join(root, "dotfiles")
+	pointer, oid := lfsPointer("font data")
+	if err := os.MkdirAll(filepath.Join(root, "shared"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(srcDir, ".fonts"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "shared", "a.ttf"), []byte(pointer), 0644); err != nil {
+		t.Fatalf("Failed to write pointer file: %v", err)
+	}
+	if err := os.Symlink(filepath.Join("..", "..", "shared", "a.ttf"), filepath.Join(srcDir, ".fonts", "a.ttf")); err != nil {
+		t.Fatalf("Failed to create file link: %v", err)
+	}
+	if err := os.Symlink(filepath.Join("..", "shared"), filepath.Join(srcDir, ".icons")); err != nil {
+		t.Fatalf("Failed to create directory link: %v", err)
+	}
+
+	fetch := func(ctx context.Context, requested string, size int64, dst string) error {
+		if requested != oid {
+			return fmt.Errorf("unexpected object %s", requested)
+		}
+		return os.WriteFile(dst, []byte("font data"), 0644)
+	}
+
+	destDir := t.TempDir()
+	options := &fs.CopyOptions{LFS: fetch, Root: root}
+	if err := fs.CopyDotFiles(context.Background(), srcDir, destDir, options); err != nil {
+		t.Fatalf("CopyDotFiles failed: %v", err)
+	}
+	for _, name := range []string{".fonts/a.ttf", ".icons/a.ttf"} {
+		content, err := os.ReadFile(filepath.Join(destDir, filepath.FromSlash(name)))
+		if err != nil || string(content) != "font data" {
+			t.Errorf("%s content = %q, %v, want %q", name, string(content), err, "font data")
+		}
+	}
+}
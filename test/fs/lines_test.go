@@ -0,0 +1,72 @@
+package fs
+
+import (
+	"testing"
+
+	"github.com/rsvinicius/dotme/internal/fs"
+)
+
+// TestMergeLines tests the line-union merge of ignore files
+func TestMergeLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		incoming string
+		expected string
+	}{
+		{
+			name:     "missing lines are appended",
+			existing: "# Project\nbuild/\n",
+			incoming: "node_modules/\nbuild/\n.env\n",
+			expected: "# Project\nbuild/\n\nnode_modules/\n.env\n",
+		},
+		{
+			name:     "nothing missing",
+			existing: "b\na\n",
+			incoming: "a\n\nb\n",
+			expected: "b\na\n",
+		},
+		{
+			name:     "comments come with their lines",
+			existing: "dist/\n",
+			incoming: "# Dependencies\nnode_modules/\n\n# Build\ndist/\n",
+			expected: "dist/\n\n# Dependencies\nnode_modules/\n",
+		},
+		{
+			name:     "no final line break",
+			existing: "a",
+			incoming: "b",
+			expected: "a\n\nb\n",
+		},
+		{
+			name:     "existing blank line is reused",
+			existing: "a\n\n",
+			incoming: "b\nb\n",
+			expected: "a\n\nb\n",
+		},
+		{
+			name:     "trailing whitespace is ignored",
+			existing: "a  \r\n",
+			incoming: "a\nb\n",
+			expected: "a  \r\n\r\nb\r\n",
+		},
+		{
+			name:     "empty existing file",
+			existing: "",
+			incoming: "# Logs\n*.log\n",
+			expected: "# Logs\n*.log\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged := fs.MergeLines([]byte(tt.existing), []byte(tt.incoming))
+			if string(merged) != tt.expected {
+				t.Errorf("MergeLines = %q, want %q", merged, tt.expected)
+			}
+			if again := fs.MergeLines(merged, []byte(tt.incoming)); string(again) != string(merged) {
+				t.Errorf("Merging again = %q, want %q", again, merged)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rsvinicius/dotme/internal/fs"
+)
+
+// TestParseLinkMode tests parsing link granularities
+func TestParseLinkMode(t *testing.T) {
+	tests := []struct {
+		name        string
+		expected    fs.LinkMode
+		expectError bool
+	}{
+		{"", fs.LinkNone, false},
+		{"file", fs.LinkFiles, false},
+		{"dir", fs.LinkDirs, false},
+		{"hard", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mode, err := fs.ParseLinkMode(tt.name)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("ParseLinkMode(%q) error = %v, expectError %v", tt.name, err, tt.expectError)
+			}
+			if mode != tt.expected {
+				t.Errorf("ParseLinkMode(%q) = %q, want %q", tt.name, mode, tt.expected)
+			}
+		})
+	}
+}
+
+// TestCopyDotFilesLink tests linking dotfiles per file and per root directory
+func TestCopyDotFilesLink(t *testing.T) {
+	tests := []struct {
+		name          string
+		mode          fs.LinkMode
+		expectedLinks []string // Destination paths expected to be links into the source
+		expectedDirs  []string // Destination paths expected to be real directories
+	}{
+		{"file", fs.LinkFiles, []string{".bashrc", ".config/tool/settings.json"}, []string{".config", ".config/tool"}},
+		{"dir", fs.LinkDirs, []string{".bashrc", ".config"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srcDir := t.TempDir()
+			destDir := t.TempDir()
+			writeFiles(t, srcDir, map[string]string{".bashrc": "alias", ".config/tool/settings.json": "{}"}, 0644)
+
+			options := &fs.CopyOptions{Link: tt.mode}
+			if err := fs.CopyDotFiles(context.Background(), srcDir, destDir, options); err != nil {
+				t.Fatalf("CopyDotFiles failed: %v", err)
+			}
+
+			for _, name := range tt.expectedLinks {
+				target, err := os.Readlink(filepath.Join(destDir, name))
+				if err != nil {
+					t.Fatalf("%s should be a link: %v", name, err)
+				}
+				if want := filepath.Join(srcDir, name); target != want {
+					t.Errorf("%s links to %s, want %s", name, target, want)
+				}
+			}
+			for _, name := range tt.expectedDirs {
+				info, err := os.Lstat(filepath.Join(destDir, name))
+				if err != nil || !info.IsDir() {
+					t.Errorf("%s should be a real directory, got %v", name, err)
+				}
+			}
+
+			// Applying again leaves every link unchanged
+			plan, err := fs.PlanDotFiles(context.Background(), srcDir, destDir, options)
+			if err != nil {
+				t.Fatalf("PlanDotFiles failed: %v", err)
+			}
+			defer plan.Close()
+			for _, action := range plan.Actions {
+				if action.Change != fs.ChangeUnchanged {
+					t.Errorf("%s change = %v on second apply, want unchanged", action.Path, action.Change)
+				}
+			}
+		})
+	}
+}
+
+// TestCopyDotFilesLinkExisting tests linking over existing links, files and directories
+func TestCopyDotFilesLinkExisting(t *testing.T) {
+	srcDir := t.TempDir()
+	destDir := t.TempDir()
+	otherDir := t.TempDir()
+	writeFiles(t, srcDir, map[string]string{".bashrc": "alias", ".vimrc": "set", ".config/tool/settings.json": "{}"}, 0644)
+	writeFiles(t, otherDir, map[string]string{".bashrc": "other"}, 0644)
+	writeFiles(t, destDir, map[string]string{".vimrc": "existing"}, 0644)
+	if err := os.Symlink(filepath.Join(otherDir, ".bashrc"), filepath.Join(destDir, ".bashrc")); err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(destDir, ".config"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	// Existing directories are never replaced by a link
+	options := &fs.CopyOptions{Link: fs.LinkDirs, OnConflict: fs.ConflictBackup}
+	if err := fs.CopyDotFiles(context.Background(), srcDir, destDir, options); err == nil {
+		t.Fatal("CopyDotFiles should refuse to replace an existing directory with a link")
+	}
+
+	options.Link = fs.LinkFiles
+	if err := fs.CopyDotFiles(context.Background(), srcDir, destDir, options); err != nil {
+		t.Fatalf("CopyDotFiles failed: %v", err)
+	}
+
+	expected := map[string]string{
+		".bashrc":     filepath.Join(srcDir, ".bashrc"),
+		".bashrc.bak": filepath.Join(otherDir, ".bashrc"),
+		".vimrc":      filepath.Join(srcDir, ".vimrc"),
+	}
+	for name, want := range expected {
+		target, err := os.Readlink(filepath.Join(destDir, name))
+		if err != nil {
+			t.Fatalf("%s should be a link: %v", name, err)
+		}
+		if target != want {
+			t.Errorf("%s links to %s, want %s", name, target, want)
+		}
+	}
+
+	// The linked-to file of a replaced link is never modified
+	content, err := os.ReadFile(filepath.Join(otherDir, ".bashrc"))
+	if err != nil || string(content) != "other" {
+		t.Errorf("Target of the replaced link = %q, %v, want %q", string(content), err, "other")
+	}
+	content, err = os.ReadFile(filepath.Join(destDir, ".vimrc.bak"))
+	if err != nil || string(content) != "existing" {
+		t.Errorf(".vimrc.bak content = %q, %v, want %q", string(content), err, "existing")
+	}
+}
+
+// TestCopyDotFilesLinkRollback tests that a failed link apply restores replaced links
+func TestCopyDotFilesLinkRollback(t *testing.T) {
+	srcDir := t.TempDir()
+	destDir := t.TempDir()
+	writeFiles(t, srcDir, map[string]string{".bashrc": "alias", ".z": "last"}, 0644)
+	if err := os.Symlink("/elsewhere/.bashrc", filepath.Join(destDir, ".bashrc")); err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+
+	failing := func(ctx context.Context, action *fs.FileAction) error {
+		if action.Path == ".z" {
+			return errors.New("permission denied")
+		}
+		return nil
+	}
+	err := fs.CopyDotFiles(context.Background(), srcDir, destDir, &fs.CopyOptions{Link: fs.LinkFiles, Journal: failing})
+	if err == nil {
+		t.Fatal("CopyDotFiles should fail when a link cannot be written")
+	}
+
+	target, err := os.Readlink(filepath.Join(destDir, ".bashrc"))
+	if err != nil || target != "/elsewhere/.bashrc" {
+		t.Errorf(".bashrc links to %q, %v, want the original link", target, err)
+	}
+	if _, err := os.Lstat(filepath.Join(destDir, ".z")); !os.IsNotExist(err) {
+		t.Errorf(".z should not exist after rollback, got %v", err)
+	}
+}
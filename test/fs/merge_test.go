@@ -0,0 +1,228 @@
+package fs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rsvinicius/dotme/internal/fs"
+)
+
+// TestParseConflictRule tests parsing per-pattern conflict strategies
+func TestParseConflictRule(t *testing.T) {
+	tests := []struct {
+		value       string
+		expected    fs.ConflictRule
+		expectError bool
+	}{
+		{"merge:.vscode/*.json", fs.ConflictRule{Pattern: ".vscode/*.json", Strategy: fs.ConflictMerge}, false},
+		{"skip:.bashrc", fs.ConflictRule{Pattern: ".bashrc", Strategy: fs.ConflictSkip}, false},
+		{"merge", fs.ConflictRule{}, true},
+		{"merge:", fs.ConflictRule{}, true},
+		{"replace:.bashrc", fs.ConflictRule{}, true},
+		{"merge:[", fs.ConflictRule{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			rule, err := fs.ParseConflictRule(tt.value)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("ParseConflictRule(%q) error = %v, expectError %v", tt.value, err, tt.expectError)
+			}
+			if rule != tt.expected {
+				t.Errorf("ParseConflictRule(%q) = %+v, want %+v", tt.value, rule, tt.expected)
+			}
+		})
+	}
+}
+
+// TestMergeJSON tests deep-merging JSON and JSONC documents
+func TestMergeJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		incoming string
+		arrays   fs.ArrayMerge
+		expected string
+	}{
+		{
+			name:     "new keys are added",
+			existing: "{\n  \"a\": 1\n}\n",
+			incoming: `{"b": 2}`,
+			expected: "{\n  \"a\": 1,\n  \"b\": 2\n}\n",
+		},
+		{
+			name:     "incoming values win",
+			existing: "{\n    \"a\": 1,\n    \"b\": true\n}",
+			incoming: `{"a": 2}`,
+			expected: "{\n    \"a\": 2,\n    \"b\": true\n}",
+		},
+		{
+			name:     "nested objects are merged",
+			existing: "{\n  \"files.exclude\": {\n    \"**/.git\": true\n  }\n}\n",
+			incoming: `{"files.exclude": {"**/node_modules": true}}`,
+			expected: "{\n  \"files.exclude\": {\n    \"**/.git\": true,\n    \"**/node_modules\": true\n  }\n}\n",
+		},
+		{
+			name:     "comments and trailing commas",
+			existing: "// Project settings\n{\n  // Tabs\n  \"editor.tabSize\": 2, // two\n  /* theme */\n  \"theme\": \"dark\",\n}\n",
+			incoming: "{\n  // Rulers\n  \"editor.rulers\": [80,],\n}",
+			expected: "// Project settings\n{\n  // Tabs\n  \"editor.tabSize\": 2, // two\n  /* theme */\n  \"theme\": \"dark\",\n  // Rulers\n  \"editor.rulers\": [80]\n}\n",
+		},
+		{
+			name:     "arrays replaced",
+			existing: `{"a": [1, 2]}`,
+			incoming: `{"a": [2, 3]}`,
+			expected: `{"a": [2, 3]}`,
+		},
+		{
+			name:     "arrays union",
+			existing: `{"a": [1, {"x": 1, "y": 2}]}`,
+			incoming: `{"a": [{"y": 2, "x": 1}, 3, 1]}`,
+			arrays:   fs.ArraysUnion,
+			expected: `{"a": [1, {"x": 1, "y": 2}, 3]}`,
+		},
+		{
+			name:     "arrays kept",
+			existing: `{"a": [1, 2]}`,
+			incoming: `{"a": [3], "b": [4]}`,
+			arrays:   fs.ArraysKeep,
+			expected: `{"a": [1, 2], "b": [4]}`,
+		},
+		{
+			name:     "type changes take the incoming value",
+			existing: `{"a": {"b": 1}}`,
+			incoming: `{"a": "flat"}`,
+			expected: `{"a": "flat"}`,
+		},
+		{
+			name:     "unchanged content is kept as written",
+			existing: "{ \"a\" :1,\n\"b\": [ 1 ] , }",
+			incoming: `{"a": 1}`,
+			expected: "{ \"a\" :1,\n\"b\": [ 1 ] , }",
+		},
+		{
+			name:     "empty existing file",
+			existing: "\n",
+			incoming: `{"a": 1}`,
+			expected: `{"a": 1}`,
+		},
+		{
+			name:     "escaped keys",
+			existing: `{"\u0061b": 1}`,
+			incoming: `{"ab": 2}`,
+			expected: `{"\u0061b": 2}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, err := fs.MergeJSON([]byte(tt.existing), []byte(tt.incoming), tt.arrays)
+			if err != nil {
+				t.Fatalf("MergeJSON failed: %v", err)
+			}
+			if string(merged) != tt.expected {
+				t.Errorf("MergeJSON =\n%s\nwant\n%s", merged, tt.expected)
+			}
+
+			// Merging again changes nothing
+			again, err := fs.MergeJSON(merged, []byte(tt.incoming), tt.arrays)
+			if err != nil {
+				t.Fatalf("MergeJSON failed: %v", err)
+			}
+			if string(again) != string(merged) {
+				t.Errorf("Merging again =\n%s\nwant\n%s", again, merged)
+			}
+		})
+	}
+}
+
+// TestMergeJSONInvalid tests that invalid documents are refused
+func TestMergeJSONInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		incoming string
+	}{
+		{"unterminated object", `{"a": 1`, `{}`},
+		{"missing comma", `{"a": 1 "b": 2}`, `{}`},
+		{"unquoted key", `{a: 1}`, `{}`},
+		{"unterminated comment", `{} /* note`, `{}`},
+		{"invalid incoming", `{}`, `{"a": tru}`},
+		{"two values", `{} {}`, `{}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := fs.MergeJSON([]byte(tt.existing), []byte(tt.incoming), fs.ArraysReplace); err == nil {
+				t.Error("MergeJSON should fail")
+			}
+		})
+	}
+}
+
+// TestCopyDotFilesMerge tests applying with a merge rule
+func TestCopyDotFilesMerge(t *testing.T) {
+	srcDir := t.TempDir()
+	destDir := t.TempDir()
+	writeFiles(t, srcDir, map[string]string{
+		".vscode/settings.json": `{"editor.tabSize": 2}`,
+		".vscode/notes.txt":     "incoming",
+		".gitignore":            "node_modules/\n.env\n",
+		".ignore":               "vendor/\n",
+	}, 0644)
+	writeFiles(t, destDir, map[string]string{
+		".vscode/settings.json": "{\n  // Project\n  \"go.lintTool\": \"golangci-lint\"\n}\n",
+		".vscode/notes.txt":     "existing",
+		".gitignore":            "# Project\n.env\n",
+		".ignore":               "dist/\n",
+	}, 0600)
+
+	options := &fs.CopyOptions{
+		ConflictRules: []fs.ConflictRule{
+			{Pattern: ".vscode/*.json", Strategy: fs.ConflictMerge},
+			{Pattern: ".*ignore", Strategy: fs.ConflictMerge},
+		},
+	}
+	if err := fs.CopyDotFiles(context.Background(), srcDir, destDir, options); err != nil {
+		t.Fatalf("CopyDotFiles failed: %v", err)
+	}
+
+	expected := map[string]string{
+		".vscode/settings.json": "{\n  // Project\n  \"go.lintTool\": \"golangci-lint\",\n  \"editor.tabSize\": 2\n}\n",
+		".vscode/notes.txt":     "incoming",
+		".gitignore":            "# Project\n.env\n\nnode_modules/\n",
+		".ignore":               "dist/\n\nvendor/\n",
+	}
+	for name, want := range expected {
+		content, err := os.ReadFile(filepath.Join(destDir, name))
+		if err != nil || string(content) != want {
+			t.Errorf("%s content = %q, %v, want %q", name, string(content), err, want)
+		}
+	}
+	if info, err := os.Stat(filepath.Join(destDir, ".vscode/settings.json")); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Merged file should keep its mode, got %v, %v", info.Mode().Perm(), err)
+	}
+
+	// Applying again leaves the merged file unchanged
+	plan, err := fs.PlanDotFiles(context.Background(), srcDir, destDir, options)
+	if err != nil {
+		t.Fatalf("PlanDotFiles failed: %v", err)
+	}
+	defer plan.Close()
+	for _, action := range plan.Actions {
+		if action.Path != ".vscode/notes.txt" && action.Change != fs.ChangeUnchanged {
+			t.Errorf("%s change = %v on second apply, want unchanged", action.Path, action.Change)
+		}
+	}
+
+	// Files that cannot be merged are refused before anything is written
+	options.ConflictRules = append(options.ConflictRules, fs.ConflictRule{Pattern: "*.txt", Strategy: fs.ConflictMerge})
+	if err := os.WriteFile(filepath.Join(destDir, ".vscode/notes.txt"), []byte("changed"), 0600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := fs.CopyDotFiles(context.Background(), srcDir, destDir, options); err == nil {
+		t.Error("CopyDotFiles should refuse to merge a text file")
+	}
+}
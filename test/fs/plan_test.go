@@ -0,0 +1,95 @@
+package fs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rsvinicius/dotme/internal/fs"
+)
+
+// writeFiles creates files with the given content and mode below dir
+func writeFiles(t *testing.T, dir string, files map[string]string, mode os.FileMode) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory for %s: %v", name, err)
+		}
+		if err := os.WriteFile(path, []byte(content), mode); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		if err := os.Chmod(path, mode); err != nil {
+			t.Fatalf("Failed to change mode of %s: %v", name, err)
+		}
+	}
+}
+
+// TestPlanDotFiles tests that the plan reports created, overwritten and unchanged files
+func TestPlanDotFiles(t *testing.T) {
+	srcDir := t.TempDir()
+	destDir := t.TempDir()
+	writeFiles(t, srcDir, map[string]string{
+		".bashrc":               "bash config",
+		".editorconfig":         "root = true",
+		".vscode/settings.json": "{}",
+		".vscode/launch.json":   "{\"version\": 1}",
+		"README.md":             "readme",
+	}, 0644)
+	writeFiles(t, srcDir, map[string]string{".local/bin/tool": "#!/bin/sh"}, 0755)
+	writeFiles(t, destDir, map[string]string{
+		".editorconfig":         "root = true",
+		".vscode/settings.json": "{\"editor.tabSize\": 2}",
+	}, 0644)
+	writeFiles(t, destDir, map[string]string{".local/bin/tool": "#!/bin/sh"}, 0644)
+
+	plan, err := fs.PlanDotFiles(context.Background(), srcDir, destDir, nil)
+	if err != nil {
+		t.Fatalf("PlanDotFiles failed: %v", err)
+	}
+	defer plan.Close()
+
+	expected := map[string]fs.Change{
+		".bashrc":               fs.ChangeCreate,
+		".editorconfig":         fs.ChangeUnchanged,
+		".vscode/settings.json": fs.ChangeOverwrite,
+		".vscode/launch.json":   fs.ChangeCreate,
+		".local/bin/tool":       fs.ChangeOverwrite,
+	}
+	if len(plan.Actions) != len(expected) {
+		t.Errorf("Plan has %d actions, want %d", len(plan.Actions), len(expected))
+	}
+	for _, action := range plan.Actions {
+		change, ok := expected[action.Path]
+		if !ok {
+			t.Errorf("Unexpected action for %s", action.Path)
+			continue
+		}
+		if action.Change != change {
+			t.Errorf("%s change = %s, want %s", action.Path, action.Change, change)
+		}
+	}
+}
+
+// TestCopyDotFilesDryRun tests that a dry run leaves the destination untouched
+func TestCopyDotFilesDryRun(t *testing.T) {
+	srcDir := t.TempDir()
+	destDir := t.TempDir()
+	writeFiles(t, srcDir, map[string]string{
+		".bashrc":               "bash config",
+		".vscode/settings.json": "{}",
+	}, 0644)
+	writeFiles(t, destDir, map[string]string{".bashrc": "local config"}, 0644)
+
+	if err := fs.CopyDotFiles(context.Background(), srcDir, destDir, &fs.CopyOptions{DryRun: true}); err != nil {
+		t.Fatalf("CopyDotFiles failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(destDir, ".bashrc"))
+	if err != nil || string(content) != "local config" {
+		t.Errorf(".bashrc content = %q (%v), want %q", string(content), err, "local config")
+	}
+	if _, err := os.Stat(filepath.Join(destDir, ".vscode")); !os.IsNotExist(err) {
+		t.Error("Dry run should not create directories")
+	}
+}
@@ -0,0 +1,69 @@
+package fs
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/rsvinicius/dotme/internal/fs"
+)
+
+// TestConflictPrompt tests the answers accepted by the conflict prompt
+func TestConflictPrompt(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		expected    []fs.ConflictStrategy
+		expectError bool
+	}{
+		{"overwrite then keep", "o\nk\n", []fs.ConflictStrategy{fs.ConflictOverwrite, fs.ConflictSkip}, false},
+		{"default keeps", "\n\n", []fs.ConflictStrategy{fs.ConflictSkip, fs.ConflictSkip}, false},
+		{"backup", "b\no\n", []fs.ConflictStrategy{fs.ConflictBackup, fs.ConflictOverwrite}, false},
+		{"overwrite all", "O\n", []fs.ConflictStrategy{fs.ConflictOverwrite, fs.ConflictOverwrite}, false},
+		{"back up all", "B\n", []fs.ConflictStrategy{fs.ConflictBackup, fs.ConflictBackup}, false},
+		{"unknown answer is asked again", "x\nd\nK\n", []fs.ConflictStrategy{fs.ConflictSkip, fs.ConflictSkip}, false},
+		{"abort", "q\n", []fs.ConflictStrategy{fs.ConflictFail}, false},
+		{"no more input", "o\n", []fs.ConflictStrategy{fs.ConflictOverwrite}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action := planAction(t, ".bashrc", map[string]string{".bashrc": "new\n"}, map[string]string{".bashrc": "old\n"})
+
+			var out bytes.Buffer
+			resolve := fs.NewConflictPrompt(strings.NewReader(tt.input), &out, false, false)
+			for i, want := range tt.expected {
+				choice, err := resolve(action)
+				if err != nil {
+					t.Fatalf("Answer %d failed: %v", i, err)
+				}
+				if choice != want {
+					t.Errorf("Answer %d = %q, want %q", i, choice, want)
+				}
+			}
+
+			if tt.expectError {
+				if _, err := resolve(action); err == nil {
+					t.Error("Prompt should fail when no answer can be read")
+				}
+			}
+		})
+	}
+}
+
+// TestConflictPromptDiff tests that the diff of the conflicting file can be viewed
+func TestConflictPromptDiff(t *testing.T) {
+	action := planAction(t, ".bashrc", map[string]string{".bashrc": "new\n"}, map[string]string{".bashrc": "old\n"})
+
+	var out bytes.Buffer
+	resolve := fs.NewConflictPrompt(strings.NewReader("d\no\n"), &out, false, false)
+	if _, err := resolve(action); err != nil {
+		t.Fatalf("Prompt failed: %v", err)
+	}
+
+	for _, expected := range []string{".bashrc already exists and differs", "-old\n+new\n"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Prompt output %q does not contain %q", out.String(), expected)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package fs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rsvinicius/dotme/internal/fs"
+)
+
+// TestParseSymlinkPolicy tests parsing symlink policy names
+func TestParseSymlinkPolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		expected    fs.SymlinkPolicy
+		expectError bool
+	}{
+		{"", fs.SymlinksFollow, false},
+		{"preserve", fs.SymlinksPreserve, false},
+		{"follow", fs.SymlinksFollow, false},
+		{"skip", fs.SymlinksSkip, false},
+		{"copy", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := fs.ParseSymlinkPolicy(tt.name)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("ParseSymlinkPolicy(%q) error = %v, expectError %v", tt.name, err, tt.expectError)
+			}
+			if policy != tt.expected {
+				t.Errorf("ParseSymlinkPolicy(%q) = %q, want %q", tt.name, policy, tt.expected)
+			}
+		})
+	}
+}
+
+// symlinkSource creates a source with a file link, a directory link and an
+// absolute link, all pointing inside the source
+func symlinkSource(t *testing.T) string {
+	srcDir := t.TempDir()
+	writeFiles(t, srcDir, map[string]string{".shell/zshrc": "zsh", ".config/nvim-real/init.vim": "vim"}, 0644)
+	links := map[string]string{
+		".zshrc":       ".shell/zshrc",
+		".config/nvim": "nvim-real",
+		".profile":     filepath.Join(srcDir, ".shell", "zshrc"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(srcDir, name)); err != nil {
+			t.Fatalf("Failed to create link %s: %v", name, err)
+		}
+	}
+	return srcDir
+}
+
+// TestCopyDotFilesSymlinks tests each symlink policy
+func TestCopyDotFilesSymlinks(t *testing.T) {
+	tests := []struct {
+		policy        fs.SymlinkPolicy
+		expectedLinks map[string]string // Destination links and their targets
+		expectedFiles map[string]string // Destination regular files and their content
+		expectedGone  []string          // Destination paths that must not exist
+	}{
+		{
+			policy:        fs.SymlinksPreserve,
+			expectedLinks: map[string]string{".zshrc": ".shell/zshrc", ".config/nvim": "nvim-real", ".profile": ".shell/zshrc"},
+			expectedFiles: map[string]string{".config/nvim-real/init.vim": "vim"},
+		},
+		{
+			policy:        fs.SymlinksFollow,
+			expectedFiles: map[string]string{".zshrc": "zsh", ".profile": "zsh", ".config/nvim/init.vim": "vim"},
+		},
+		{
+			policy:        fs.SymlinksSkip,
+			expectedFiles: map[string]string{".shell/zshrc": "zsh"},
+			expectedGone:  []string{".zshrc", ".profile", ".config/nvim"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			srcDir := symlinkSource(t)
+			destDir := t.TempDir()
+
+			options := &fs.CopyOptions{Symlinks: tt.policy}
+			if err := fs.CopyDotFiles(context.Background(), srcDir, destDir, options); err != nil {
+				t.Fatalf("CopyDotFiles failed: %v", err)
+			}
+
+			for name, want := range tt.expectedLinks {
+				target, err := os.Readlink(filepath.Join(destDir, name))
+				if err != nil {
+					t.Fatalf("%s should be a link: %v", name, err)
+				}
+				if target != want {
+					t.Errorf("%s links to %s, want %s", name, target, want)
+				}
+			}
+			for name, want := range tt.expectedFiles {
+				path := filepath.Join(destDir, name)
+				if info, err := os.Lstat(path); err != nil || !info.Mode().IsRegular() {
+					t.Fatalf("%s should be a regular file, got %v", name, err)
+				}
+				content, _ := os.ReadFile(path)
+				if string(content) != want {
+					t.Errorf("%s content = %q, want %q", name, string(content), want)
+				}
+			}
+			for _, name := range tt.expectedGone {
+				if _, err := os.Lstat(filepath.Join(destDir, name)); !os.IsNotExist(err) {
+					t.Errorf("%s should not exist, got %v", name, err)
+				}
+			}
+
+			// Applying again leaves everything unchanged
+			plan, err := fs.PlanDotFiles(context.Background(), srcDir, destDir, options)
+			if err != nil {
+				t.Fatalf("PlanDotFiles failed: %v", err)
+			}
+			defer plan.Close()
+			for _, action := range plan.Actions {
+				if action.Change != fs.ChangeUnchanged {
+					t.Errorf("%s change = %v on second apply, want unchanged", action.Path, action.Change)
+				}
+			}
+		})
+	}
+}
+
+// TestCopyDotFilesRejectedSymlinks tests links that cannot be applied
+func TestCopyDotFilesRejectedSymlinks(t *testing.T) {
+	outside := t.TempDir()
+	writeFiles(t, outside, map[string]string{"secret": "secret"}, 0600)
+
+	tests := []struct {
+		name   string
+		link   string // Path of the link inside the source
+		target string
+		policy fs.SymlinkPolicy
+	}{
+		{"absolute outside", ".secret", filepath.Join(outside, "secret"), fs.SymlinksPreserve},
+		{"relative outside", ".secret", "../../secret", fs.SymlinksPreserve},
+		{"followed outside", ".secret", filepath.Join(outside, "secret"), fs.SymlinksFollow},
+		{"followed dangling", ".missing", "missing", fs.SymlinksFollow},
+		{"followed parent", ".config/loop", "..", fs.SymlinksFollow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srcDir := t.TempDir()
+			destDir := t.TempDir()
+			writeFiles(t, srcDir, map[string]string{".config/settings": "{}"}, 0644)
+			if err := os.Symlink(tt.target, filepath.Join(srcDir, tt.link)); err != nil {
+				t.Fatalf("Failed to create link: %v", err)
+			}
+
+			err := fs.CopyDotFiles(context.Background(), srcDir, destDir, &fs.CopyOptions{Symlinks: tt.policy})
+			if err == nil {
+				t.Fatal("CopyDotFiles should reject the link")
+			}
+
+			entries, _ := os.ReadDir(destDir)
+			if len(entries) != 0 {
+				t.Errorf("Destination should be untouched, found %d entries", len(entries))
+			}
+		})
+	}
+}
+
+// TestCopyDotFilesSymlinkRoot tests that links in a subdirectory may point
+// elsewhere in the repository when the root is given
+func TestCopyDotFilesSymlinkRoot(t *testing.T) {
+	repoDir := t.TempDir()
+	writeFiles(t, repoDir, map[string]string{"common/zshrc": "zsh"}, 0644)
+	srcDir := filepath.Join(repoDir, "work")
+	if err := os.MkdirAll(srcDir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.Symlink("../common/zshrc", filepath.Join(srcDir, ".zshrc")); err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+
+	options := &fs.CopyOptions{Symlinks: fs.SymlinksFollow}
+	if err := fs.CopyDotFiles(context.Background(), srcDir, t.TempDir(), options); err == nil {
+		t.Error("CopyDotFiles should reject links outside the source directory without a root")
+	}
+
+	destDir := t.TempDir()
+	options.Root = repoDir
+	if err := fs.CopyDotFiles(context.Background(), srcDir, destDir, options); err != nil {
+		t.Fatalf("CopyDotFiles failed: %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(destDir, ".zshrc"))
+	if err != nil || string(content) != "zsh" {
+		t.Errorf(".zshrc content = %q, %v, want %q", string(content), err, "zsh")
+	}
+}
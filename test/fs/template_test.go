@@ -0,0 +1,107 @@
+package fs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rsvinicius/dotme/internal/fs"
+)
+
+// TestCopyDotFilesTemplates tests rendering .tmpl files into files without the suffix
+func TestCopyDotFilesTemplates(t *testing.T) {
+	data := map[string]any{
+		"OS":   "linux",
+		"Vars": map[string]string{"email": "me@example.com"},
+	}
+
+	tests := []struct {
+		name            string
+		files           map[string]string
+		link            fs.LinkMode
+		expectedPath    string
+		expectedContent string
+		expectError     bool
+	}{
+		{
+			name:            "root template",
+			files:           map[string]string{".gitconfig.tmpl": "email = {{ .Vars.email }}"},
+			expectedPath:    ".gitconfig",
+			expectedContent: "email = me@example.com",
+		},
+		{
+			name:            "nested template with conditionals",
+			files:           map[string]string{".config/tool.conf.tmpl": `{{ if eq .OS "linux" }}linux{{ else }}other{{ end }}`},
+			expectedPath:    ".config/tool.conf",
+			expectedContent: "linux",
+		},
+		{
+			name:            "rendered even when linking",
+			files:           map[string]string{".gitconfig.tmpl": "{{ .OS }}"},
+			link:            fs.LinkFiles,
+			expectedPath:    ".gitconfig",
+			expectedContent: "linux",
+		},
+		{
+			name:            "bare suffix is not a template",
+			files:           map[string]string{".config/.tmpl": "{{ .OS }}"},
+			expectedPath:    ".config/.tmpl",
+			expectedContent: "{{ .OS }}",
+		},
+		{
+			name:        "missing variable",
+			files:       map[string]string{".gitconfig.tmpl": "{{ .Vars.name }}"},
+			expectError: true,
+		},
+		{
+			name:        "syntax error",
+			files:       map[string]string{".gitconfig.tmpl": "{{ .OS "},
+			expectError: true,
+		},
+		{
+			name:        "template and plain file clash",
+			files:       map[string]string{".gitconfig.tmpl": "{{ .OS }}", ".gitconfig": "plain"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srcDir := t.TempDir()
+			destDir := t.TempDir()
+			writeFiles(t, srcDir, tt.files, 0644)
+
+			options := &fs.CopyOptions{TemplateData: data, Link: tt.link}
+			err := fs.CopyDotFiles(context.Background(), srcDir, destDir, options)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("CopyDotFiles error = %v, expectError %v", err, tt.expectError)
+			}
+			if tt.expectError {
+				return
+			}
+
+			path := filepath.Join(destDir, filepath.FromSlash(tt.expectedPath))
+			if info, err := os.Lstat(path); err != nil || !info.Mode().IsRegular() {
+				t.Fatalf("%s should be a regular file, got %v", tt.expectedPath, err)
+			}
+			content, _ := os.ReadFile(path)
+			if string(content) != tt.expectedContent {
+				t.Errorf("%s content = %q, want %q", tt.expectedPath, string(content), tt.expectedContent)
+			}
+			if _, err := os.Stat(path + ".tmpl"); !os.IsNotExist(err) {
+				t.Errorf("Template should not be copied as is, got %v", err)
+			}
+
+			// Rendering the same content again leaves the file unchanged
+			plan, err := fs.PlanDotFiles(context.Background(), srcDir, destDir, options)
+			if err != nil {
+				t.Fatalf("PlanDotFiles failed: %v", err)
+			}
+			defer plan.Close()
+			if len(plan.Actions) != 1 || plan.Actions[0].Change != fs.ChangeUnchanged {
+				t.Errorf("Second apply should leave the rendered file unchanged")
+			}
+		})
+	}
+}
@@ -0,0 +1,306 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rsvinicius/dotme/internal/git"
+	"github.com/rsvinicius/dotme/test/mocks"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"plain", "https://github.com/user/dotfiles", "https://github.com/user/dotfiles"},
+		{"git suffix", "https://github.com/user/dotfiles.git", "https://github.com/user/dotfiles"},
+		{"trailing slash", "https://github.com/user/dotfiles/", "https://github.com/user/dotfiles"},
+		{"host case", "HTTPS://GitHub.com/user/dotfiles", "https://github.com/user/dotfiles"},
+		{"scp-like", "git@github.com:user/dotfiles.git", "git@github.com:user/dotfiles"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := git.NormalizeURL(tt.input)
+			if result != tt.expected {
+				t.Errorf("NormalizeURL(%q) = %q, want %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+// TestRepoName tests deriving repository names from URLs
+func TestRepoName(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"https", "https://github.com/user/dotfiles.git", "dotfiles"},
+		{"scp-like", "git@github.com:user/my-dotfiles.git", "my-dotfiles"},
+		{"local path", "/home/user/src/dotfiles/", "dotfiles"},
+		{"unsafe characters", "https://example.com/user/dot+files", "dot-files"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := git.RepoName(tt.input); result != tt.expected {
+				t.Errorf("RepoName(%q) = %q, want %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+// TestCloneRepositoryCache tests that cached clones are reused and updated
+func TestCloneRepositoryCache(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	repoDir, commits := setupRefsRepository(t)
+
+	first, err := git.CloneRepository(context.Background(), repoDir, &git.CloneOptions{Cache: true})
+	if err != nil {
+		t.Fatalf("CloneRepository failed: %v", err)
+	}
+	if err := first.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := os.Stat(first.Dir); err != nil {
+		t.Fatalf("Cached clone should be kept after Close: %v", err)
+	}
+	if first.Commit != commits["head"] {
+		t.Errorf("Commit = %s, want %s", first.Commit, commits["head"])
+	}
+
+	// Update the remote and make sure the cached clone picks up the change
+	newHead := mocks.CommitFiles(t, repoDir, map[string]string{".gitconfig": "updated"}, "update")
+
+	tests := []struct {
+		name           string
+		ref            string
+		expectedCommit string
+		expectedConfig string
+	}{
+		{"fetch new commit", "", newHead, "updated"},
+		{"branch", "feature", commits["feature"], "feature"},
+		{"tag", "v1.0.0", commits["tag"], "v1"},
+		{"commit outside shallow history", commits["head"], commits["head"], "head"},
+		{"back to default branch", "", newHead, "updated"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, err := git.CloneRepository(context.Background(), repoDir, &git.CloneOptions{Ref: tt.ref, Cache: true})
+			if err != nil {
+				t.Fatalf("CloneRepository failed: %v", err)
+			}
+			defer repo.Close()
+
+			if repo.Dir != first.Dir {
+				t.Errorf("Dir = %s, want cached dir %s", repo.Dir, first.Dir)
+			}
+			if repo.Commit != tt.expectedCommit {
+				t.Errorf("Commit = %s, want %s", repo.Commit, tt.expectedCommit)
+			}
+
+			content, err := os.ReadFile(filepath.Join(repo.Dir, ".gitconfig"))
+			if err != nil {
+				t.Fatalf("Failed to read checked out file: %v", err)
+			}
+			if string(content) != tt.expectedConfig {
+				t.Errorf(".gitconfig content = %q, want %q", string(content), tt.expectedConfig)
+			}
+		})
+	}
+}
+
+// TestCacheManagement tests listing, pruning and clearing the cache
+func TestCacheManagement(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	repoDir, _ := mocks.GitRepository(t, map[string]string{".gitconfig": "content"})
+
+	repo, err := git.CloneRepository(context.Background(), repoDir, &git.CloneOptions{Cache: true})
+	if err != nil {
+		t.Fatalf("CloneRepository failed: %v", err)
+	}
+
+	entries, err := git.ListCache()
+	if err != nil {
+		t.Fatalf("ListCache failed: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 cache entry, got %d", len(entries))
+	}
+	if entries[0].URL != repoDir || entries[0].Commit != repo.Commit {
+		t.Errorf("Unexpected cache entry: %+v", entries[0])
+	}
+
+	pruned, err := git.PruneCache(time.Hour)
+	if err != nil {
+		t.Fatalf("PruneCache failed: %v", err)
+	}
+	if len(pruned) != 0 {
+		t.Errorf("Recently fetched entry should not be pruned, pruned %d", len(pruned))
+	}
+
+	pruned, err = git.PruneCache(0)
+	if err != nil {
+		t.Fatalf("PruneCache failed: %v", err)
+	}
+	if len(pruned) != 1 {
+		t.Errorf("Expected 1 pruned entry, got %d", len(pruned))
+	}
+
+	if _, err := git.CloneRepository(context.Background(), repoDir, &git.CloneOptions{Cache: true}); err != nil {
+		t.Fatalf("CloneRepository failed: %v", err)
+	}
+	if err := git.ClearCache(); err != nil {
+		t.Fatalf("ClearCache failed: %v", err)
+	}
+	entries, err = git.ListCache()
+	if err != nil {
+		t.Fatalf("ListCache failed: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected empty cache after clear, got %d entries", len(entries))
+	}
+}
+
+// TestCacheLock tests that cache entries locked by another process are
+// neither updated nor removed, and that stale locks are taken over
+func TestCacheLock(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	repoDir, _ := mocks.GitRepository(t, map[string]string{".gitconfig": "content"})
+
+	if _, err := git.CloneRepository(context.Background(), repoDir, &git.CloneOptions{Cache: true}); err != nil {
+		t.Fatalf("CloneRepository failed: %v", err)
+	}
+	entries, err := git.ListCache()
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("ListCache = %d entries, %v, want 1", len(entries), err)
+	}
+
+	// Simulate another process holding the lock
+	lockFile := entries[0].Dir + ".lock"
+	if err := os.WriteFile(lockFile, []byte("1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write lock file: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if _, err := git.CloneRepository(ctx, repoDir, &git.CloneOptions{Cache: true}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("CloneRepository of a locked entry: err = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if pruned, err := git.PruneCache(0); err != nil || len(pruned) != 0 {
+		t.Errorf("PruneCache = %d entries, %v, want a locked entry to be kept", len(pruned), err)
+	}
+	if err := git.ClearCache(); err == nil {
+		t.Error("ClearCache should report a locked entry")
+	}
+	if _, err := os.Stat(entries[0].Dir); err != nil {
+		t.Fatalf("Locked entry should be kept: %v", err)
+	}
+
+	// A lock that is not refreshed was left behind by a process that died
+	stale := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(lockFile, stale, stale); err != nil {
+		t.Fatalf("Failed to age lock file: %v", err)
+	}
+	if _, err := git.CloneRepository(context.Background(), repoDir, &git.CloneOptions{Cache: true}); err != nil {
+		t.Fatalf("CloneRepository should take over a stale lock: %v", err)
+	}
+	if _, err := os.Stat(lockFile); !os.IsNotExist(err) {
+		t.Errorf("Lock file should be removed once released, got %v", err)
+	}
+	if err := git.ClearCache(); err != nil {
+		t.Fatalf("ClearCache failed: %v", err)
+	}
+}
+
+// TestCloneRepositoryOffline tests applying cached copies without the remote
+func TestCloneRepositoryOffline(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	repoDir, commits := setupRefsRepository(t)
+
+	if _, err := git.CloneRepository(context.Background(), repoDir, &git.CloneOptions{Offline: true, Cache: true}); !errors.Is(err, git.ErrNotCached) {
+		t.Fatalf("Offline clone of an uncached repository: err = %v, want %v", err, git.ErrNotCached)
+	}
+
+	// Populate the cache with the default branch and a tag
+	for _, ref := range []string{"", "v1.0.0"} {
+		if _, err := git.CloneRepository(context.Background(), repoDir, &git.CloneOptions{Ref: ref, Cache: true}); err != nil {
+			t.Fatalf("CloneRepository(%q) failed: %v", ref, err)
+		}
+	}
+
+	repo, err := git.CloneRepository(context.Background(), repoDir, &git.CloneOptions{Offline: true, Cache: true})
+	if err != nil {
+		t.Fatalf("Offline CloneRepository failed: %v", err)
+	}
+	if !repo.Offline || repo.Commit != commits["head"] || repo.FetchedAt.IsZero() {
+		t.Errorf("Unexpected offline repository: %+v", repo)
+	}
+
+	if _, err := git.CloneRepository(context.Background(), repoDir, &git.CloneOptions{Ref: "feature", Offline: true, Cache: true}); err == nil {
+		t.Error("Offline clone of an uncached branch should fail")
+	}
+}
+
+// gitHTTPServer serves the repositories in root over HTTP with git
+// http-backend, skipping the test when git is not installed
+func gitHTTPServer(t *testing.T, root string) *httptest.Server {
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git is not installed")
+	}
+	server := httptest.NewServer(&cgi.Handler{
+		Path:   gitPath,
+		Args:   []string{"http-backend"},
+		Env:    []string{"GIT_PROJECT_ROOT=" + root, "GIT_HTTP_EXPORT_ALL=1", "GIT_CONFIG_NOSYSTEM=1"},
+		Stderr: io.Discard,
+	})
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestCloneRepositoryFallback tests that only an unreachable remote falls
+// back to the cached copy, while errors reported by the remote are returned
+func TestCloneRepositoryFallback(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	repoDir, commits := setupRefsRepository(t)
+	server := gitHTTPServer(t, filepath.Dir(repoDir))
+	repoURL := server.URL + "/" + filepath.Base(repoDir)
+
+	if _, err := git.CloneRepository(context.Background(), repoURL, &git.CloneOptions{Ref: "v1.0.0", Cache: true}); err != nil {
+		t.Fatalf("CloneRepository failed: %v", err)
+	}
+
+	// A repository missing on a reachable server is an error
+	if err := os.Rename(repoDir, repoDir+"-moved"); err != nil {
+		t.Fatalf("Failed to move repository: %v", err)
+	}
+	if _, err := git.CloneRepository(context.Background(), repoURL, &git.CloneOptions{Ref: "v1.0.0", Cache: true}); err == nil {
+		t.Error("CloneRepository should report a missing repository instead of falling back to the cache")
+	}
+	if err := os.Rename(repoDir+"-moved", repoDir); err != nil {
+		t.Fatalf("Failed to restore repository: %v", err)
+	}
+
+	// An unreachable server falls back to the cache
+	server.Close()
+	repo, err := git.CloneRepository(context.Background(), repoURL, &git.CloneOptions{Ref: "v1.0.0", Cache: true})
+	if err != nil {
+		t.Fatalf("CloneRepository should fall back to the cache: %v", err)
+	}
+	if !repo.Offline || repo.Commit != commits["tag"] {
+		t.Errorf("Unexpected fallback repository: %+v", repo)
+	}
+}
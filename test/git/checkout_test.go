@@ -0,0 +1,168 @@
+package git
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/rsvinicius/dotme/internal/git"
+	"github.com/rsvinicius/dotme/test/mocks"
+)
+
+// TestCheckoutDir tests naming persistent checkouts after aliases and URLs
+func TestCheckoutDir(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	reposDir := filepath.Join(home, ".dotme", "repos")
+
+	tests := []struct {
+		name        string
+		checkout    string
+		expected    string
+		expectError bool
+	}{
+		{"alias", "work", filepath.Join(reposDir, "work"), false},
+		{"unsafe alias", "my/work", filepath.Join(reposDir, "my-work"), false},
+		{"invalid alias", "..", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := git.CheckoutDir("https://github.com/user/dotfiles", tt.checkout)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("CheckoutDir error = %v, expectError %v", err, tt.expectError)
+			}
+			if dir != tt.expected {
+				t.Errorf("CheckoutDir = %q, want %q", dir, tt.expected)
+			}
+		})
+	}
+
+	// Without a name the checkout is named after the URL
+	dir, err := git.CheckoutDir("https://github.com/user/dotfiles", "")
+	if err != nil {
+		t.Fatalf("CheckoutDir failed: %v", err)
+	}
+	if filepath.Dir(dir) != reposDir {
+		t.Errorf("CheckoutDir = %q, want a directory in %s", dir, reposDir)
+	}
+}
+
+// TestCloneRepositoryCheckout tests that checkouts are kept, updated and
+// never updated over local changes
+func TestCloneRepositoryCheckout(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	repoDir, commits := setupRefsRepository(t)
+	checkoutDir := filepath.Join(t.TempDir(), "work")
+
+	first, err := git.CloneRepository(context.Background(), repoDir, &git.CloneOptions{Dir: checkoutDir})
+	if err != nil {
+		t.Fatalf("CloneRepository failed: %v", err)
+	}
+	if err := first.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if first.Dir != checkoutDir || first.Commit != commits["head"] {
+		t.Errorf("Checkout = %s at %s, want %s at %s", first.Dir, first.Commit, checkoutDir, commits["head"])
+	}
+	if _, err := os.Stat(filepath.Join(checkoutDir, ".gitconfig")); err != nil {
+		t.Fatalf("Checkout should be kept after Close: %v", err)
+	}
+
+	newHead := mocks.CommitFiles(t, repoDir, map[string]string{".gitconfig": "updated"}, "update")
+	second, err := git.CloneRepository(context.Background(), repoDir, &git.CloneOptions{Dir: checkoutDir})
+	if err != nil {
+		t.Fatalf("CloneRepository failed to update the checkout: %v", err)
+	}
+	if second.Commit != newHead {
+		t.Errorf("Commit = %s, want %s", second.Commit, newHead)
+	}
+
+	if err := os.WriteFile(filepath.Join(checkoutDir, ".gitconfig"), []byte("edited"), 0644); err != nil {
+		t.Fatalf("Failed to edit checkout: %v", err)
+	}
+	if _, err := git.CloneRepository(context.Background(), repoDir, &git.CloneOptions{Dir: checkoutDir}); err == nil {
+		t.Error("CloneRepository should refuse to update a checkout with local changes")
+	}
+	content, _ := os.ReadFile(filepath.Join(checkoutDir, ".gitconfig"))
+	if string(content) != "edited" {
+		t.Errorf("Local change was lost, .gitconfig = %q", string(content))
+	}
+
+	otherDir, _ := mocks.GitRepository(t, map[string]string{".gitconfig": "other"})
+	if _, err := git.CloneRepository(context.Background(), otherDir, &git.CloneOptions{Dir: checkoutDir}); err == nil {
+		t.Error("CloneRepository should refuse a checkout of another repository")
+	}
+}
+
+// checkoutHead returns the branch the checkout at dir is on, empty when its
+// HEAD is detached, and the commit it points to
+func checkoutHead(t *testing.T, dir string) (string, string) {
+	r, err := gogit.PlainOpen(dir)
+	if err != nil {
+		t.Fatalf("Failed to open checkout: %v", err)
+	}
+	head, err := r.Reference(plumbing.HEAD, false)
+	if err != nil {
+		t.Fatalf("Failed to read HEAD: %v", err)
+	}
+	resolved, err := r.Head()
+	if err != nil {
+		t.Fatalf("Failed to resolve HEAD: %v", err)
+	}
+	if head.Type() != plumbing.SymbolicReference {
+		return "", resolved.Hash().String()
+	}
+	return head.Target().Short(), resolved.Hash().String()
+}
+
+// TestCloneRepositoryCheckoutBranch tests that checkouts are on a local branch
+// that is fast-forwarded on update, and never moved over unpushed commits
+func TestCloneRepositoryCheckoutBranch(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	repoDir, commits := setupRefsRepository(t)
+	checkoutDir := filepath.Join(t.TempDir(), "work")
+	upstream, _ := checkoutHead(t, repoDir)
+
+	if _, err := git.CloneRepository(context.Background(), repoDir, &git.CloneOptions{Dir: checkoutDir}); err != nil {
+		t.Fatalf("CloneRepository failed: %v", err)
+	}
+	if branch, commit := checkoutHead(t, checkoutDir); branch != upstream || commit != commits["head"] {
+		t.Errorf("Checkout HEAD = %q at %s, want %q at %s", branch, commit, upstream, commits["head"])
+	}
+
+	newHead := mocks.CommitFiles(t, repoDir, map[string]string{".gitconfig": "updated"}, "update")
+	if _, err := git.CloneRepository(context.Background(), repoDir, &git.CloneOptions{Dir: checkoutDir}); err != nil {
+		t.Fatalf("CloneRepository failed to update the checkout: %v", err)
+	}
+	if branch, commit := checkoutHead(t, checkoutDir); branch != upstream || commit != newHead {
+		t.Errorf("Checkout HEAD after update = %q at %s, want %q at %s", branch, commit, upstream, newHead)
+	}
+
+	if _, err := git.CloneRepository(context.Background(), repoDir, &git.CloneOptions{Dir: checkoutDir, Ref: "feature"}); err != nil {
+		t.Fatalf("CloneRepository failed to switch branch: %v", err)
+	}
+	if branch, commit := checkoutHead(t, checkoutDir); branch != "feature" || commit != commits["feature"] {
+		t.Errorf("Checkout HEAD on feature = %q at %s, want %q at %s", branch, commit, "feature", commits["feature"])
+	}
+	if _, err := git.CloneRepository(context.Background(), repoDir, &git.CloneOptions{Dir: checkoutDir}); err != nil {
+		t.Fatalf("CloneRepository failed to switch back: %v", err)
+	}
+
+	localCommit := mocks.CommitFiles(t, checkoutDir, map[string]string{".gitconfig": "local"}, "local change")
+	mocks.CommitFiles(t, repoDir, map[string]string{".gitconfig": "remote"}, "remote change")
+	if _, err := git.CloneRepository(context.Background(), repoDir, &git.CloneOptions{Dir: checkoutDir}); err == nil {
+		t.Error("CloneRepository should refuse to update a checkout with unpushed commits")
+	}
+	if branch, commit := checkoutHead(t, checkoutDir); branch != upstream || commit != localCommit {
+		t.Errorf("Checkout HEAD after refusal = %q at %s, want %q at %s", branch, commit, upstream, localCommit)
+	}
+	content, _ := os.ReadFile(filepath.Join(checkoutDir, ".gitconfig"))
+	if string(content) != "local" {
+		t.Errorf("Local commit was lost, .gitconfig = %q", string(content))
+	}
+}
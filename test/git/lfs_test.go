@@ -0,0 +1,209 @@
+package git
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rsvinicius/dotme/internal/git"
+	"github.com/rsvinicius/dotme/test/mocks"
+)
+
+// lfsServer serves a single object through the Git LFS batch API
+func lfsServer(t *testing.T, oid, content, token string) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/dotfiles.git/info/lfs/objects/batch":
+			if _, password, _ := r.BasicAuth(); password != token {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			var request struct {
+				Objects []struct {
+					Oid string `json:"oid"`
+				} `json:"objects"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil || len(request.Objects) != 1 {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			object := map[string]interface{}{"oid": request.Objects[0].Oid, "size": len(content)}
+			if request.Objects[0].Oid == oid {
+				object["actions"] = map[string]interface{}{
+					"download": map[string]interface{}{
+						"href":   server.URL + "/objects/" + oid,
+						"header": map[string]string{"X-Download": "yes"},
+					},
+				}
+			} else {
+				object["error"] = map[string]interface{}{"code": 404, "message": "Object does not exist"}
+			}
+			w.Header().Set("Content-Type", "application/vnd.git-lfs+json")
+			json.NewEncoder(w).Encode(map[string]interface{}{"objects": []interface{}{object}})
+		case "/objects/" + oid:
+			if r.Header.Get("X-Download") != "yes" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Write([]byte(content))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return server
+}
+
+// TestFetchLFSObject tests downloading LFS objects through the batch API and
+// reusing them from the cached clone
+func TestFetchLFSObject(t *testing.T) {
+	isolateAuth(t)
+
+	content := "font data"
+	sum := sha256.Sum256([]byte(content))
+	oid := hex.EncodeToString(sum[:])
+	server := lfsServer(t, oid, content, "secret")
+
+	repoDir, _ := mocks.GitRepository(t, map[string]string{
+		".lfsconfig": "[lfs]\n\turl = " + strings.Replace(server.URL, "://", "://me:secret@", 1) + "/dotfiles.git/info/lfs\n",
+	})
+
+	repo, err := git.CloneRepository(context.Background(), repoDir, &git.CloneOptions{Cache: true})
+	if err != nil {
+		t.Fatalf("CloneRepository failed: %v", err)
+	}
+	defer repo.Close()
+
+	dst := filepath.Join(t.TempDir(), "a.ttf")
+	if err := repo.FetchLFSObject(context.Background(), oid, int64(len(content)), dst); err != nil {
+		t.Fatalf("FetchLFSObject failed: %v", err)
+	}
+	if data, err := os.ReadFile(dst); err != nil || string(data) != content {
+		t.Errorf("Fetched content = %q (%v), want %q", string(data), err, content)
+	}
+
+	if err := repo.FetchLFSObject(context.Background(), oid, int64(len(content))+1, dst); err == nil {
+		t.Error("FetchLFSObject should fail for an object with the wrong size")
+	}
+	missing := sha256.Sum256([]byte("missing"))
+	if err := repo.FetchLFSObject(context.Background(), hex.EncodeToString(missing[:]), 7, dst); err == nil {
+		t.Error("FetchLFSObject should fail for an object unknown to the server")
+	}
+
+	// Fetched objects are kept in the cached clone
+	server.Close()
+	if err := repo.FetchLFSObject(context.Background(), oid, int64(len(content)), dst); err != nil {
+		t.Errorf("FetchLFSObject should use the stored object: %v", err)
+	}
+}
+
+// TestFetchLFSObjectUnauthorized tests that missing credentials are reported
+func TestFetchLFSObjectUnauthorized(t *testing.T) {
+	isolateAuth(t)
+
+	content := "font data"
+	sum := sha256.Sum256([]byte(content))
+	oid := hex.EncodeToString(sum[:])
+	server := lfsServer(t, oid, content, "secret")
+	defer server.Close()
+
+	repoDir, _ := mocks.GitRepository(t, map[string]string{
+		".lfsconfig": "[lfs]\n\turl = " + server.URL + "/dotfiles.git/info/lfs\n",
+	})
+
+	repo, err := git.CloneRepository(context.Background(), repoDir, nil)
+	if err != nil {
+		t.Fatalf("CloneRepository failed: %v", err)
+	}
+	defer repo.Close()
+
+	if err := repo.FetchLFSObject(context.Background(), oid, int64(len(content)), filepath.Join(t.TempDir(), "a.ttf")); err == nil {
+		t.Error("FetchLFSObject should fail without credentials")
+	}
+}
+
+// TestFetchLFSObjectForeignEndpoint tests that credentials are not sent to an
+// lfs.url from .lfsconfig that is not on the host of the remote
+func TestFetchLFSObjectForeignEndpoint(t *testing.T) {
+	home := isolateAuth(t)
+	netrcPath := filepath.Join(home, "netrc")
+	if err := os.WriteFile(netrcPath, []byte("default login me password secret\n"), 0600); err != nil {
+		t.Fatalf("Failed to write netrc: %v", err)
+	}
+	t.Setenv("NETRC", netrcPath)
+	t.Setenv("DOTME_GIT_TOKEN", "secret")
+
+	requested := false
+	authorization := ""
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = true
+		authorization = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	// Trust the certificate of the test server
+	defaultTransport := http.DefaultTransport
+	http.DefaultTransport = server.Client().Transport
+	t.Cleanup(func() { http.DefaultTransport = defaultTransport })
+
+	repoDir, _ := mocks.GitRepository(t, map[string]string{
+		".lfsconfig": "[lfs]\n\turl = " + server.URL + "/dotfiles.git/info/lfs\n",
+	})
+
+	repo, err := git.CloneRepository(context.Background(), repoDir, nil)
+	if err != nil {
+		t.Fatalf("CloneRepository failed: %v", err)
+	}
+	defer repo.Close()
+
+	sum := sha256.Sum256([]byte("font data"))
+	if err := repo.FetchLFSObject(context.Background(), hex.EncodeToString(sum[:]), 9, filepath.Join(t.TempDir(), "a.ttf")); err == nil {
+		t.Error("FetchLFSObject should fail without credentials")
+	}
+	if !requested {
+		t.Fatal("The Git LFS endpoint should be contacted")
+	}
+	if authorization != "" {
+		t.Errorf("No credentials should be sent, got Authorization %q", authorization)
+	}
+}
+
+// TestFetchLFSObjectLocalRemote tests taking objects from the LFS store of a local remote
+func TestFetchLFSObjectLocalRemote(t *testing.T) {
+	isolateAuth(t)
+
+	content := "icon data"
+	sum := sha256.Sum256([]byte(content))
+	oid := hex.EncodeToString(sum[:])
+
+	repoDir, _ := mocks.GitRepository(t, map[string]string{".bashrc": "bash"})
+	store := filepath.Join(repoDir, ".git", "lfs", "objects", oid[0:2], oid[2:4])
+	if err := os.MkdirAll(store, 0755); err != nil {
+		t.Fatalf("Failed to create LFS store: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(store, oid), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write LFS object: %v", err)
+	}
+
+	repo, err := git.CloneRepository(context.Background(), repoDir, nil)
+	if err != nil {
+		t.Fatalf("CloneRepository failed: %v", err)
+	}
+	defer repo.Close()
+
+	dst := filepath.Join(t.TempDir(), "icon.png")
+	if err := repo.FetchLFSObject(context.Background(), oid, int64(len(content)), dst); err != nil {
+		t.Fatalf("FetchLFSObject failed: %v", err)
+	}
+	if data, err := os.ReadFile(dst); err != nil || string(data) != content {
+		t.Errorf("Fetched content = %q (%v), want %q", string(data), err, content)
+	}
+}
@@ -0,0 +1,175 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/rsvinicius/dotme/internal/git"
+	"github.com/rsvinicius/dotme/test/mocks"
+)
+
+// setupRefsRepository creates a repository with a tag, a feature branch and
+// a default branch that moved on after the tag was created
+func setupRefsRepository(t *testing.T) (string, map[string]string) {
+	repoDir, commit := mocks.GitRepository(t, map[string]string{".gitconfig": "v1"})
+
+	r, err := gogit.PlainOpen(repoDir)
+	if err != nil {
+		t.Fatalf("failed to open repository: %v", err)
+	}
+	head, err := r.Head()
+	if err != nil {
+		t.Fatalf("failed to get HEAD: %v", err)
+	}
+	defaultBranch := head.Name()
+	tagCommit := head.Hash().String()
+
+	if _, err := r.CreateTag("v1.0.0", head.Hash(), nil); err != nil {
+		t.Fatalf("failed to create tag: %v", err)
+	}
+
+	worktree, err := r.Worktree()
+	if err != nil {
+		t.Fatalf("failed to open worktree: %v", err)
+	}
+	if err := worktree.Checkout(&gogit.CheckoutOptions{Branch: plumbing.NewBranchReferenceName("feature"), Create: true}); err != nil {
+		t.Fatalf("failed to create feature branch: %v", err)
+	}
+	featureCommit := commit(map[string]string{".gitconfig": "feature"}, "feature commit")
+
+	if err := worktree.Checkout(&gogit.CheckoutOptions{Branch: defaultBranch}); err != nil {
+		t.Fatalf("failed to check out default branch: %v", err)
+	}
+	headCommit := commit(map[string]string{".gitconfig": "head"}, "head commit")
+
+	return repoDir, map[string]string{
+		"tag":     tagCommit,
+		"feature": featureCommit,
+		"head":    headCommit,
+	}
+}
+
+// TestCloneRepositoryRefs tests that branches, tags and commits are checked out
+func TestCloneRepositoryRefs(t *testing.T) {
+	repoDir, commits := setupRefsRepository(t)
+
+	tests := []struct {
+		name           string
+		ref            string
+		expectedCommit string
+		expectedConfig string
+	}{
+		{"default branch", "", commits["head"], "head"},
+		{"branch", "feature", commits["feature"], "feature"},
+		{"tag", "v1.0.0", commits["tag"], "v1"},
+		{"full commit", commits["feature"], commits["feature"], "feature"},
+		{"short commit", commits["tag"][:7], commits["tag"], "v1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, err := git.CloneRepository(context.Background(), repoDir, &git.CloneOptions{Ref: tt.ref})
+			if err != nil {
+				t.Fatalf("CloneRepository failed: %v", err)
+			}
+			defer os.RemoveAll(repo.Dir)
+
+			if repo.Commit != tt.expectedCommit {
+				t.Errorf("Commit = %s, want %s", repo.Commit, tt.expectedCommit)
+			}
+
+			content, err := os.ReadFile(filepath.Join(repo.Dir, ".gitconfig"))
+			if err != nil {
+				t.Fatalf("Failed to read checked out file: %v", err)
+			}
+			if string(content) != tt.expectedConfig {
+				t.Errorf(".gitconfig content = %q, want %q", string(content), tt.expectedConfig)
+			}
+		})
+	}
+}
+
+// TestCloneRepositoryUnknownRef tests that an unknown ref is reported as an error
+func TestCloneRepositoryUnknownRef(t *testing.T) {
+	repoDir, _ := setupRefsRepository(t)
+
+	repo, err := git.CloneRepository(context.Background(), repoDir, &git.CloneOptions{Ref: "does-not-exist"})
+	if err == nil {
+		os.RemoveAll(repo.Dir)
+		t.Fatal("CloneRepository should fail for an unknown ref")
+	}
+}
+
+// TestCloneRepositoryDepth tests that clones are shallow unless a full clone is requested
+func TestCloneRepositoryDepth(t *testing.T) {
+	repoDir, commits := setupRefsRepository(t)
+
+	tests := []struct {
+		name            string
+		options         *git.CloneOptions
+		expectedShallow bool
+	}{
+		{"default branch", &git.CloneOptions{}, true},
+		{"branch", &git.CloneOptions{Ref: "feature"}, true},
+		{"tag", &git.CloneOptions{Ref: "v1.0.0"}, true},
+		{"commit falls back to full clone", &git.CloneOptions{Ref: commits["tag"]}, false},
+		{"full clone", &git.CloneOptions{FullClone: true}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, err := git.CloneRepository(context.Background(), repoDir, tt.options)
+			if err != nil {
+				t.Fatalf("CloneRepository failed: %v", err)
+			}
+			defer os.RemoveAll(repo.Dir)
+
+			_, err = os.Stat(filepath.Join(repo.Dir, ".git", "shallow"))
+			shallow := err == nil
+			if shallow != tt.expectedShallow {
+				t.Errorf("shallow = %v, want %v", shallow, tt.expectedShallow)
+			}
+		})
+	}
+}
+
+// TestCloneRepositoryCancelled tests that a cancelled clone fails without
+// leaving temporary directories behind or falling back to the cached copy
+func TestCloneRepositoryCancelled(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	tempDir := t.TempDir()
+	t.Setenv("TMPDIR", tempDir)
+	repoDir, _ := setupRefsRepository(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := git.CloneRepository(ctx, repoDir, nil); err == nil {
+		t.Fatal("CloneRepository should fail when the context is cancelled")
+	}
+	if entries, _ := os.ReadDir(tempDir); len(entries) != 0 {
+		t.Errorf("Temporary directories were left behind: %v", entries)
+	}
+
+	// A cancelled update must not be mistaken for an unreachable remote
+	repo, err := git.CloneRepository(context.Background(), repoDir, &git.CloneOptions{Cache: true})
+	if err != nil {
+		t.Fatalf("CloneRepository failed: %v", err)
+	}
+	repo.Close()
+
+	repo, err = git.CloneRepository(ctx, repoDir, &git.CloneOptions{Cache: true})
+	if err == nil {
+		repo.Close()
+		t.Fatal("CloneRepository should fail when the context is cancelled")
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("CloneRepository error = %v, want %v", err, context.Canceled)
+	}
+}
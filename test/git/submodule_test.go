@@ -0,0 +1,89 @@
+package git
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/rsvinicius/dotme/internal/git"
+	"github.com/rsvinicius/dotme/test/mocks"
+)
+
+// runGit runs a git command in dir, skipping the test when git is not installed
+func runGit(t *testing.T, dir string, args ...string) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@example.com",
+		"GIT_CONFIG_NOSYSTEM=1")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v failed: %v\n%s", args, err, output)
+	}
+}
+
+// setupSubmoduleRepository creates a repository with a .vim submodule, which
+// has a nested pack/plugin submodule
+func setupSubmoduleRepository(t *testing.T) string {
+	pluginDir, _ := mocks.GitRepository(t, map[string]string{"plugin.vim": "let g:plugin = 1"})
+	vimDir, _ := mocks.GitRepository(t, map[string]string{"colors/theme.vim": "colorscheme desert"})
+	runGit(t, vimDir, "-c", "protocol.file.allow=always", "submodule", "add", pluginDir, "pack/plugin")
+	runGit(t, vimDir, "commit", "-m", "add plugin submodule")
+	repoDir, _ := mocks.GitRepository(t, map[string]string{".gitconfig": "[user]"})
+
+	runGit(t, repoDir, "-c", "protocol.file.allow=always", "submodule", "add", vimDir, ".vim")
+	runGit(t, repoDir, "commit", "-m", "add vim submodule")
+	return repoDir
+}
+
+// TestCloneRepositorySubmodules tests that submodules are checked out unless disabled
+func TestCloneRepositorySubmodules(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	repoDir := setupSubmoduleRepository(t)
+
+	tests := []struct {
+		name         string
+		options      *git.CloneOptions
+		expectExists bool
+	}{
+		{"temporary clone", &git.CloneOptions{}, true},
+		{"cached clone", &git.CloneOptions{Cache: true}, true},
+		{"cached clone update", &git.CloneOptions{Cache: true}, true},
+		{"offline", &git.CloneOptions{Cache: true, Offline: true}, true},
+		{"no submodules", &git.CloneOptions{NoSubmodules: true}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, err := git.CloneRepository(context.Background(), repoDir, tt.options)
+			if err != nil {
+				t.Fatalf("CloneRepository failed: %v", err)
+			}
+			defer repo.Close()
+
+			content, err := os.ReadFile(filepath.Join(repo.Dir, ".vim", "colors", "theme.vim"))
+			if !tt.expectExists {
+				if err == nil {
+					t.Error("Submodule should not be checked out")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to read submodule file: %v", err)
+			}
+			if string(content) != "colorscheme desert" {
+				t.Errorf("Submodule file content = %q, want %q", string(content), "colorscheme desert")
+			}
+			content, err = os.ReadFile(filepath.Join(repo.Dir, ".vim", "pack", "plugin", "plugin.vim"))
+			if err != nil || string(content) != "let g:plugin = 1" {
+				t.Errorf("Nested submodule file content = %q, %v, want %q", string(content), err, "let g:plugin = 1")
+			}
+		})
+	}
+}
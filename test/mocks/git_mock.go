@@ -4,6 +4,10 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
 )
 
 // MockRepository creates a mock git repository in a temporary directory
@@ -82,3 +86,56 @@ func MockRepository(t *testing.T) (string, string) {
 
 	return repoDir, destDir
 }
+
+// GitRepository creates a real git repository in a temporary directory with an
+// initial commit containing the given files. It returns the repository directory
+// and a function that commits further changes to the current branch.
+func GitRepository(t *testing.T, files map[string]string) (string, func(files map[string]string, message string) string) {
+	repoDir := t.TempDir()
+
+	if _, err := git.PlainInit(repoDir, false); err != nil {
+		t.Fatalf("failed to initialize git repository: %v", err)
+	}
+
+	commit := func(files map[string]string, message string) string {
+		return CommitFiles(t, repoDir, files, message)
+	}
+	commit(files, "initial commit")
+
+	return repoDir, commit
+}
+
+// CommitFiles writes the given files into a git repository and commits them
+// to the current branch, returning the hash of the new commit
+func CommitFiles(t *testing.T, repoDir string, files map[string]string, message string) string {
+	r, err := git.PlainOpen(repoDir)
+	if err != nil {
+		t.Fatalf("failed to open git repository: %v", err)
+	}
+
+	worktree, err := r.Worktree()
+	if err != nil {
+		t.Fatalf("failed to open worktree: %v", err)
+	}
+
+	for name, content := range files {
+		path := filepath.Join(repoDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory for %s: %v", name, err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+		if _, err := worktree.Add(name); err != nil {
+			t.Fatalf("failed to stage %s: %v", name, err)
+		}
+	}
+
+	hash, err := worktree.Commit(message, &git.CommitOptions{
+		Author: &object.Signature{Name: "dotme", Email: "dotme@example.com", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	return hash.String()
+}
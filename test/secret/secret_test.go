@@ -0,0 +1,142 @@
+package secret
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rsvinicius/dotme/internal/secret"
+)
+
+// TestEncryptDecrypt tests that encrypted files only decrypt with the same secret
+func TestEncryptDecrypt(t *testing.T) {
+	plaintext := []byte("//registry.npmjs.org/:_authToken=npm_secret\n")
+	encrypted, err := secret.Encrypt(plaintext, []byte("correct horse"))
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	if !secret.IsEncrypted(encrypted) {
+		t.Error("IsEncrypted should detect encrypted files")
+	}
+	if bytes.Contains(encrypted, []byte("npm_secret")) {
+		t.Error("Encrypted file should not contain the plaintext")
+	}
+
+	decrypted, err := secret.Decrypt(encrypted, []byte("correct horse"))
+	if err != nil {
+		t.Fatalf("Decrypt failed: %v", err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("Decrypt = %q, want %q", decrypted, plaintext)
+	}
+
+	if _, err := secret.Decrypt(encrypted, []byte("wrong horse")); !errors.Is(err, secret.ErrWrongSecret) {
+		t.Errorf("Decrypt with a wrong secret error = %v, want ErrWrongSecret", err)
+	}
+
+	tampered := bytes.Replace(encrypted, []byte("\n-----END"), []byte("A\n-----END"), 1)
+	if _, err := secret.Decrypt(tampered, []byte("correct horse")); err == nil {
+		t.Error("Decrypt should reject a modified file")
+	}
+
+	if _, err := secret.Decrypt(plaintext, []byte("correct horse")); err == nil {
+		t.Error("Decrypt should reject a file that is not encrypted")
+	}
+}
+
+// TestDecryptHostileKDF tests that key derivation parameters outside the
+// accepted bounds are refused before any key is derived
+func TestDecryptHostileKDF(t *testing.T) {
+	encrypted, err := secret.Encrypt([]byte("token=secret"), []byte("correct horse"))
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		kdf       string
+		supported bool
+	}{
+		{"weaker parameters", "scrypt N=16384 r=8 p=1", true},
+		{"N not a power of two", "scrypt N=32769 r=8 p=1", false},
+		{"N of one", "scrypt N=1 r=8 p=1", false},
+		{"huge N", "scrypt N=2097152 r=8 p=1", false},
+		{"huge r", "scrypt N=32768 r=1073741823 p=1", false},
+		{"huge p", "scrypt N=32768 r=1 p=1073741823", false},
+		{"r above bound", "scrypt N=32768 r=33 p=1", false},
+		{"p above bound", "scrypt N=32768 r=8 p=17", false},
+		{"too much memory", "scrypt N=1048576 r=32 p=1", false},
+		{"negative r", "scrypt N=32768 r=-8 p=-1", false},
+		{"zero p", "scrypt N=32768 r=8 p=0", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hostile := bytes.Replace(encrypted, []byte("KDF: scrypt N=32768 r=8 p=1"), []byte("KDF: "+tt.kdf), 1)
+			_, err := secret.Decrypt(hostile, []byte("correct horse"))
+			if tt.supported {
+				// The derived key differs from the one the file was encrypted with
+				if !errors.Is(err, secret.ErrWrongSecret) {
+					t.Errorf("Decrypt error = %v, want ErrWrongSecret", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), "unsupported key derivation") {
+				t.Errorf("Decrypt error = %v, want an unsupported key derivation", err)
+			}
+		})
+	}
+}
+
+// TestLoad tests where the secret is read from
+func TestLoad(t *testing.T) {
+	homeDir := t.TempDir()
+	t.Setenv("HOME", homeDir)
+	t.Setenv("DOTME_PASSPHRASE", "")
+
+	keyFile := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(keyFile, []byte("file secret\n"), 0600); err != nil {
+		t.Fatalf("Failed to write key file: %v", err)
+	}
+	defaultKeyFile := filepath.Join(homeDir, ".dotme", "key")
+	if err := os.MkdirAll(filepath.Dir(defaultKeyFile), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(defaultKeyFile, []byte("default secret"), 0600); err != nil {
+		t.Fatalf("Failed to write key file: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		keyFile    string
+		passphrase string
+		expected   string
+	}{
+		{"key file", keyFile, "env secret", "file secret"},
+		{"environment", "", "env secret", "env secret"},
+		{"default key file", "", "", "default secret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DOTME_PASSPHRASE", tt.passphrase)
+			key, err := secret.Load(tt.keyFile, false)
+			if err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+			if string(key) != tt.expected {
+				t.Errorf("Load = %q, want %q", key, tt.expected)
+			}
+		})
+	}
+
+	if err := os.Chmod(keyFile, 0644); err != nil {
+		t.Fatalf("Failed to change mode: %v", err)
+	}
+	if _, err := secret.Load(keyFile, false); err == nil {
+		t.Error("Load should reject key files readable by other users")
+	}
+}
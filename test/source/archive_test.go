@@ -0,0 +1,188 @@
+package source
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rsvinicius/dotme/internal/source"
+)
+
+// archiveEntry describes a file in a test archive
+type archiveEntry struct {
+	name    string
+	content string
+}
+
+// writeTarGz creates a .tar.gz archive with the given entries
+func writeTarGz(t *testing.T, path string, entries []archiveEntry) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: 0644, Size: int64(len(entry.content)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatalf("Failed to write tar header: %v", err)
+		}
+		if _, err := tw.Write([]byte(entry.content)); err != nil {
+			t.Fatalf("Failed to write tar entry: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Failed to close tar writer: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("Failed to close gzip writer: %v", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write archive: %v", err)
+	}
+}
+
+// writeZip creates a .zip archive with the given entries
+func writeZip(t *testing.T, path string, entries []archiveEntry) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		w, err := zw.Create(entry.name)
+		if err != nil {
+			t.Fatalf("Failed to create zip entry: %v", err)
+		}
+		if _, err := w.Write([]byte(entry.content)); err != nil {
+			t.Fatalf("Failed to write zip entry: %v", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to close zip writer: %v", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write archive: %v", err)
+	}
+}
+
+// TestOpenArchive tests extracting tar.gz and zip archives
+func TestOpenArchive(t *testing.T) {
+	tempDir := t.TempDir()
+	entries := []archiveEntry{
+		{".gitconfig", "git config"},
+		{".vscode/settings.json", "{}"},
+	}
+	wrapped := []archiveEntry{
+		{"dotfiles-1.0/.gitconfig", "git config"},
+		{"dotfiles-1.0/.vscode/settings.json", "{}"},
+	}
+
+	writeTarGz(t, filepath.Join(tempDir, "dotfiles.tar.gz"), entries)
+	writeTarGz(t, filepath.Join(tempDir, "wrapped.tgz"), wrapped)
+	writeZip(t, filepath.Join(tempDir, "dotfiles.zip"), entries)
+	writeZip(t, filepath.Join(tempDir, "wrapped.ZIP"), wrapped)
+
+	for _, name := range []string{"dotfiles.tar.gz", "wrapped.tgz", "dotfiles.zip", "wrapped.ZIP"} {
+		t.Run(name, func(t *testing.T) {
+			snapshot, err := source.Open(context.Background(), filepath.Join(tempDir, name), nil)
+			if err != nil {
+				t.Fatalf("Open failed: %v", err)
+			}
+
+			for _, entry := range entries {
+				content, err := os.ReadFile(filepath.Join(snapshot.Dir, entry.name))
+				if err != nil {
+					t.Errorf("Failed to read %s: %v", entry.name, err)
+					continue
+				}
+				if string(content) != entry.content {
+					t.Errorf("%s content = %q, want %q", entry.name, string(content), entry.content)
+				}
+			}
+
+			if !strings.Contains(snapshot.Revision, name) {
+				t.Errorf("Revision %q should mention the archive name", snapshot.Revision)
+			}
+
+			if err := snapshot.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+			if _, err := os.Stat(snapshot.Dir); !os.IsNotExist(err) {
+				t.Error("Extracted files should be removed on Close")
+			}
+		})
+	}
+}
+
+// TestOpenArchiveRejectsTraversal tests that entries escaping the extraction directory are rejected
+func TestOpenArchiveRejectsTraversal(t *testing.T) {
+	tempDir := t.TempDir()
+	evil := []archiveEntry{
+		{".bashrc", "ok"},
+		{"../../evil", "escaped"},
+	}
+
+	writeTarGz(t, filepath.Join(tempDir, "evil.tar.gz"), evil)
+	writeZip(t, filepath.Join(tempDir, "evil.zip"), evil)
+
+	for _, name := range []string{"evil.tar.gz", "evil.zip"} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := source.Open(context.Background(), filepath.Join(tempDir, name), nil); err == nil {
+				t.Fatal("Open should reject entries escaping the extraction directory")
+			}
+			if _, err := os.Stat(filepath.Join(os.TempDir(), "evil")); err == nil {
+				t.Error("Escaping entry was written")
+			}
+		})
+	}
+}
+
+// TestOpenArchiveRejectsBomb tests that highly compressed zip entries are rejected
+func TestOpenArchiveRejectsBomb(t *testing.T) {
+	tempDir := t.TempDir()
+	bomb := []archiveEntry{{".bashrc", strings.Repeat("\x00", 10<<20)}}
+	writeZip(t, filepath.Join(tempDir, "bomb.zip"), bomb)
+
+	_, err := source.Open(context.Background(), filepath.Join(tempDir, "bomb.zip"), nil)
+	if !errors.Is(err, source.ErrArchiveTooLarge) {
+		t.Fatalf("Open error = %v, want %v", err, source.ErrArchiveTooLarge)
+	}
+}
+
+// TestOpenArchiveURL tests downloading an archive over HTTP
+func TestOpenArchiveURL(t *testing.T) {
+	tempDir := t.TempDir()
+	archivePath := filepath.Join(tempDir, "dotfiles.tar.gz")
+	writeTarGz(t, archivePath, []archiveEntry{{".gitconfig", "downloaded"}})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/releases/dotfiles.tar.gz" {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, archivePath)
+	}))
+	defer server.Close()
+
+	snapshot, err := source.Open(context.Background(), server.URL+"/releases/dotfiles.tar.gz?token=abc", nil)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer snapshot.Close()
+
+	content, err := os.ReadFile(filepath.Join(snapshot.Dir, ".gitconfig"))
+	if err != nil {
+		t.Fatalf("Failed to read extracted file: %v", err)
+	}
+	if string(content) != "downloaded" {
+		t.Errorf(".gitconfig content = %q, want %q", string(content), "downloaded")
+	}
+
+	if _, err := source.Open(context.Background(), server.URL+"/missing.zip", nil); err == nil {
+		t.Error("Open should fail for a missing archive")
+	}
+}
@@ -0,0 +1,114 @@
+package source
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rsvinicius/dotme/internal/source"
+)
+
+func TestSplitSubdir(t *testing.T) {
+	tests := []struct {
+		name           string
+		location       string
+		expectedBase   string
+		expectedSubdir string
+	}{
+		{"no subdir", "https://github.com/org/dotfiles", "https://github.com/org/dotfiles", ""},
+		{"https subdir", "https://github.com/org/dotfiles//go", "https://github.com/org/dotfiles", "go"},
+		{"nested subdir", "https://github.com/org/dotfiles.git//sets/node/", "https://github.com/org/dotfiles.git", "sets/node"},
+		{"scp-like", "git@github.com:org/dotfiles.git//python", "git@github.com:org/dotfiles.git", "python"},
+		{"file URL", "file:///home/me/dotfiles//go", "file:///home/me/dotfiles", "go"},
+		{"local path", "/home/me/dotfiles//go", "/home/me/dotfiles", "go"},
+		{"query string", "https://example.com/dotfiles.zip//go?token=abc", "https://example.com/dotfiles.zip?token=abc", "go"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, subdir := source.SplitSubdir(tt.location)
+			if base != tt.expectedBase || subdir != tt.expectedSubdir {
+				t.Errorf("SplitSubdir(%q) = (%q, %q), want (%q, %q)",
+					tt.location, base, subdir, tt.expectedBase, tt.expectedSubdir)
+			}
+		})
+	}
+}
+
+func TestJoinSubdir(t *testing.T) {
+	tests := []struct {
+		location string
+		subdir   string
+		expected string
+	}{
+		{"https://github.com/org/dotfiles", "", "https://github.com/org/dotfiles"},
+		{"https://github.com/org/dotfiles", "go", "https://github.com/org/dotfiles//go"},
+		{"https://github.com/org/dotfiles", "/sets/node/", "https://github.com/org/dotfiles//sets/node"},
+		{"https://example.com/dotfiles.zip?token=abc", "go", "https://example.com/dotfiles.zip//go?token=abc"},
+	}
+
+	for _, tt := range tests {
+		result, err := source.JoinSubdir(tt.location, tt.subdir)
+		if err != nil {
+			t.Errorf("JoinSubdir(%q, %q) failed: %v", tt.location, tt.subdir, err)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("JoinSubdir(%q, %q) = %q, want %q", tt.location, tt.subdir, result, tt.expected)
+		}
+	}
+
+	if _, err := source.JoinSubdir("https://github.com/org/dotfiles//go", "node"); err == nil {
+		t.Error("JoinSubdir should fail when the location already has a subdirectory")
+	}
+}
+
+// TestOpenSubdir tests opening a subdirectory of a local source
+func TestOpenSubdir(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"go", "node"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+		if err := os.WriteFile(filepath.Join(root, dir, ".editorconfig"), []byte(dir), 0644); err != nil {
+			t.Fatalf("Failed to write %s/.editorconfig: %v", dir, err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		location    string
+		path        string
+		expectedDir string
+		expectError bool
+	}{
+		{"location syntax", root + "//go", "", "go", false},
+		{"path option", root, "node", "node", false},
+		{"matching location and path", root + "//go", "go", "go", false},
+		{"conflicting location and path", root + "//go", "node", "", true},
+		{"missing subdirectory", root + "//python", "", "", true},
+		{"escaping subdirectory", root, "../", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snapshot, err := source.Open(context.Background(), tt.location, &source.Options{Path: tt.path})
+			if tt.expectError {
+				if err == nil {
+					snapshot.Close()
+					t.Fatal("Open should fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Open failed: %v", err)
+			}
+			defer snapshot.Close()
+
+			if snapshot.Dir != filepath.Join(root, tt.expectedDir) {
+				t.Errorf("Dir = %s, want %s", snapshot.Dir, filepath.Join(root, tt.expectedDir))
+			}
+		})
+	}
+}